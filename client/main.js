@@ -1,5 +1,16 @@
 const baseUrl = 'http://localhost:5000' // This would need to be set from configuration.
+const siteKey = 'local-dev-key' // The website's site key, also from configuration.
 const cookieSessionID = 'session_id'
+const cookieSessionToken = 'session_token'
+const batchFlushMs = 500
+
+// Events are queued and sent to the backend in batches, which saves us a request per event.
+let eventQueue = []
+// Batches are sent one after the other, so the events are applied in the order they happened.
+let lastBatch = Promise.resolve()
+
+// Keystrokes typed in each field since it was last sent, map[inputID][]keystroke.
+let fieldKeystrokes = {}
 
 $(document).ready(() => {
 	// Get session ID from server. We expect a session ID to be returned here.
@@ -13,12 +24,15 @@ $(document).ready(() => {
 		type: 'POST',
 		data: JSON.stringify({ websiteURL: window.location.href }),
 		contentType: 'application/json',
+		headers: { 'X-Site-Key': siteKey },
 		success: (data) => {
 			// Request successful, save session id cookie and start listeners
 			Cookies.set(cookieSessionID, data.sessionID)
+			Cookies.set(cookieSessionToken, data.token)
 
-			listenForFirstResize()
+			listenForResizes()
 			listenForFieldCopyPaste()
+			listenForKeystrokes()
 			listenForTimeToSubmit()
 		},
 		error: (_, status, err) => {
@@ -28,22 +42,26 @@ $(document).ready(() => {
 	})
 })
 
-// Adds listener for resize event and removes itself after the first resize
-function listenForFirstResize() {
+// Adds listener for resize events. Every resize is sent (once the window settles), from the
+// dimensions after the previous one.
+function listenForResizes() {
 	const resizeTimeoutMs = 1000
-	const namespacedResizeEvent = 'resize.listenonce'
-	const originalW = $(window).width().toString()
-	const originalH = $(window).height().toString()
+	let lastW = $(window).width()
+	let lastH = $(window).height()
 
 	let timer
-	$(window).on(namespacedResizeEvent, (e) => {
+	$(window).on('resize', (e) => {
 		clearTimeout(timer)
 		timer = setTimeout(() => {
-			const w = $(window).width().toString()
-			const h = $(window).height().toString()
-
-			// Remove listener as we only care about the first resize.
-			$(window).off(namespacedResizeEvent);
+			const w = $(window).width()
+			const h = $(window).height()
+			if (w === lastW && h === lastH) {
+				return
+			}
+			const originalW = lastW
+			const originalH = lastH
+			lastW = w
+			lastH = h
 
 			// Create event and send it off to the backend.
 			ev = {
@@ -59,34 +77,96 @@ function listenForFirstResize() {
 					height: h,
 				},
 			}
-			postEvent(ev, baseUrl + '/new_resize_event')
+			queueEvent(ev)
 		}, resizeTimeoutMs)
 	});
 }
 
+// Sends every copy, cut and paste on an input. We never send what was copied or pasted,
+// only how long the pasted text was and whether it replaced everything in the field.
 function listenForFieldCopyPaste() {
-	var pasted = new Map(); // Map of input ID to boolean, good for lookups.
-	$('input').bind('paste', (e) => {
-		if (pasted.get(e.target.id) == null) {
-			pasted.set(e.target.id, true)
-
-			ev = {
-				eventType: 'copyAndPaste',
-				websiteURL: window.location.href,
-				sessionID: Cookies.get(cookieSessionID),
-				inputID: e.target.id,
-			}
-			postEvent(ev, baseUrl + '/new_cp_event')
+	$('input').bind('copy cut paste', (e) => {
+		ev = {
+			eventType: 'copyAndPaste',
+			websiteURL: window.location.href,
+			sessionID: Cookies.get(cookieSessionID),
+			inputID: e.target.id,
+			action: e.type,
+		}
+		if (e.type === 'paste') {
+			const clipboard = e.originalEvent.clipboardData || window.clipboardData
+			const value = e.target.value || ''
+			ev.pastedLength = clipboard ? clipboard.getData('text').length : 0
+			ev.replacedValue = value.length === 0 ||
+				(e.target.selectionStart === 0 && e.target.selectionEnd === value.length)
 		}
+		queueEvent(ev)
 	});
 }
 
+// Records when every key goes down and up in an input, and whether it's a backspace.
+// We never send (or keep) which key it was: pressed keys are only told apart by their
+// physical position (`code`) while they're down, to match them with their `keyup`.
+function listenForKeystrokes() {
+	const down = {}
+	$('input').on('keydown', (e) => {
+		if (e.originalEvent.repeat) {
+			// Holding a key down is still one keystroke
+			return
+		}
+		const keystroke = { downAt: Date.now(), backspace: e.key === 'Backspace' }
+		down[e.originalEvent.code] = keystroke
+		fieldKeystrokes[e.target.id] = fieldKeystrokes[e.target.id] || []
+		fieldKeystrokes[e.target.id].push(keystroke)
+	})
+	$('input').on('keyup', (e) => {
+		const keystroke = down[e.originalEvent.code]
+		if (keystroke) {
+			keystroke.upAt = Date.now()
+			delete down[e.originalEvent.code]
+		}
+	})
+	// Each field's keystrokes are sent when the visitor leaves it
+	$('input').on('blur', (e) => {
+		queueKeystrokes(e.target.id)
+	})
+}
+
+function queueKeystrokes(inputID) {
+	const keys = fieldKeystrokes[inputID]
+	if (!keys || keys.length === 0) {
+		return
+	}
+	delete fieldKeystrokes[inputID]
+	queueEvent({
+		eventType: 'keystrokes',
+		websiteURL: window.location.href,
+		sessionID: Cookies.get(cookieSessionID),
+		inputID: inputID,
+		keys: keys,
+	})
+}
+
 function listenForTimeToSubmit() {
 	const namespacedKeyUpEvent = 'keyup.listenonce'
 	const namespacedSubmitEvent = 'submit.listenonce'
 
+	// Every visit to a field, from focus to blur. Times are in milliseconds since the epoch;
+	// the server corrects them for our clock using sentAt.
+	const fields = []
+	const focused = {}
+	$('input').on('focus', (e) => {
+		focused[e.target.id] = Date.now()
+	})
+	$('input').on('blur', (e) => {
+		if (focused[e.target.id]) {
+			fields.push({ inputID: e.target.id, focusAt: focused[e.target.id], blurAt: Date.now() })
+			delete focused[e.target.id]
+		}
+	})
+
 	$('input').on(namespacedKeyUpEvent, (_) => {
-		const startTime = Date.now()
+		const firstKeystrokeAt = Date.now()
 
 		// Ignore subsequent `keyup` events
 		$('input').off(namespacedKeyUpEvent);
@@ -94,14 +174,30 @@ function listenForTimeToSubmit() {
 		// Start listening on form submit
 		$('form').on(namespacedSubmitEvent, (e) => {
 			e.preventDefault()
+			const submitAt = Date.now()
+
+			// Fields still focused (eg: submitted with the enter key) never blurred
+			for (const inputID in focused) {
+				fields.push({ inputID: inputID, focusAt: focused[inputID] })
+			}
 
 			ev = {
 				eventType: 'timeTaken',
 				websiteURL: window.location.href,
 				sessionID: Cookies.get(cookieSessionID),
-				timeSeconds: Math.round((Date.now() - startTime) / 1000),
+				timeSeconds: Math.round((submitAt - firstKeystrokeAt) / 1000), // For older servers
+				firstKeystrokeAt: firstKeystrokeAt,
+				submitAt: submitAt,
+				fields: fields,
+				sentAt: Date.now(),
 			}
-			postEvent(ev, baseUrl + '/new_time_taken_event', () => {
+			// Flush whatever is pending before the form is submitted and the page goes away.
+			// This completes the session, so it goes last: anything after it would be rejected.
+			for (const inputID in fieldKeystrokes) {
+				queueKeystrokes(inputID)
+			}
+			queueEvent(ev)
+			flushEvents(() => {
 				// Request completed, submit form
 				$('form').unbind(namespacedSubmitEvent).submit()
 			})
@@ -109,11 +205,36 @@ function listenForTimeToSubmit() {
 	})
 }
 
+function queueEvent(ev) {
+	eventQueue.push(ev)
+	if (eventQueue.length === 1) {
+		setTimeout(flushEvents, batchFlushMs)
+	}
+}
+
+// Sends whatever is queued once the previous batch is done, calling completeFn (if any) when
+// it's done too.
+function flushEvents(completeFn) {
+	const batch = eventQueue
+	eventQueue = []
+	lastBatch = lastBatch.then(() => new Promise((resolve) => {
+		if (batch.length === 0) {
+			resolve()
+			return
+		}
+		postEvent(batch, baseUrl + '/events/batch', resolve)
+	}))
+	if (completeFn) {
+		lastBatch.then(completeFn)
+	}
+}
+
 function postEvent(ev, url, completeFn) {
 	$.ajax(url, {
 		type: 'POST',
 		data: JSON.stringify(ev),
 		contentType: 'application/json',
+		headers: { 'X-Site-Key': siteKey, 'X-Session-Token': Cookies.get(cookieSessionToken) },
 		complete: completeFn,
 		error: (_, status, err) => {
 			// Similarly here, we could handle this better (if it errored we wouldn't remove it from the queue, for example)
@@ -1,25 +1,39 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"expvar"
 	"io/ioutil"
 	"log"
-	"math/rand"
 	"net/http"
-	"strconv"
+	"os"
 	"time"
 
 	"github.com/hugoamvieira/code-test/server/data"
 	"github.com/hugoamvieira/code-test/server/hash"
+	"github.com/hugoamvieira/code-test/server/sessionid"
+	"github.com/hugoamvieira/code-test/server/sink"
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
 )
 
 // API wraps Go's HTTP server. I've created it so it's physically and conceptually
 // separated from the rest of the code and that so that any future API modifications
 // are easier to do without changing other pieces of code (eg: Adding new things to the API struct)
 type API struct {
-	srv  *http.Server
-	rand *rand.Rand
-	sg   *sessionGen
+	srv    *http.Server
+	ids    *sessionid.Generator
+	events *eventRegistry
+	sink   sink.Sink
+	stream *streamHub
+	sites  *site.Registry
+
+	corsPolicy CORSPolicy
+	limits     *rateLimiters
+	tokens     *token.Signer
+	adminKey   string
+	stopReaper func()
 }
 
 const (
@@ -29,6 +43,17 @@ const (
 	errInvalidRequest     = `{"error": "Invalid Request Body"}`
 	errInternalServer     = `{"error": "Internal Server Error"}`
 	errSessionNonExistent = `{"error": "Session doesn't exist"}`
+	errInvalidEventType   = `{"error": "Unknown event type"}`
+	errBatchTooLarge      = `{"error": "Too many events in batch"}`
+	errSessionFinished    = `{"error": "Session has already finished"}`
+	errInvalidQuery       = `{"error": "Invalid query"}`
+	errUnknownSiteKey     = `{"error": "Unknown site key"}`
+	errSiteNotAllowed     = `{"error": "Request not allowed for this site"}`
+	errOriginNotAllowed   = `{"error": "Origin not allowed"}`
+	errRateLimited        = `{"error": "Too many requests"}`
+	errInvalidToken       = `{"error": "Invalid session token"}`
+	errExpiredToken       = `{"error": "Session token has expired"}`
+	errAdminKeyRequired   = `{"error": "Admin key required"}`
 )
 
 // New returns a new API object with a Go http server and a new serve mux with the
@@ -38,53 +63,110 @@ func New(addr string) *API {
 
 	m := http.NewServeMux()
 	m.HandleFunc("/new_session", a.handleNewSession)
-	m.HandleFunc("/new_resize_event", a.handleResizeEvent)
-	m.HandleFunc("/new_cp_event", a.handleCopyPasteEvent)
-	m.HandleFunc("/new_time_taken_event", a.handleTimeTakenEvent)
+	m.HandleFunc("/events", a.handleEvent)
+	m.HandleFunc("/events/batch", a.handleEventBatch)
+
+	// Admin routes, these show everyone's sessions.
+	m.Handle("/stream", a.requireAdmin(http.HandlerFunc(a.handleStream)))
+	m.Handle("/sessions", a.requireAdmin(http.HandlerFunc(a.handleListSessions)))
+	m.Handle("/debug/vars", a.requireAdmin(expvar.Handler()))
+
+	// Legacy per-event routes, kept so older clients still work.
+	m.HandleFunc("/new_resize_event", a.handleEventOfType(eventTypeResize))
+	m.HandleFunc("/new_cp_event", a.handleEventOfType(eventTypeCopyPaste))
+	m.HandleFunc("/new_time_taken_event", a.handleEventOfType(eventTypeTimeTaken))
 
 	a.srv = &http.Server{
 		Addr:    addr,
-		Handler: m,
+		Handler: a.cors(a.rateLimitIP(sessionsRouter(m, a.requireAdmin(http.HandlerFunc(a.handleGetSession))))),
 	}
 
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	a.rand = r
+	node, err := sessionid.RandomNode()
+	if err != nil {
+		// Not much we can do without randomness, we wouldn't be able to generate session IDs either.
+		log.Fatalln("Failed to pick a random node for session IDs | Error:", err)
+	}
+	a.ids = sessionid.NewGenerator(node)
 
-	a.sg = &sessionGen{
-		sessions: make(map[string]bool),
+	a.events = newEventRegistry()
+	a.sink = sink.NewTable(os.Stdout)
+	a.stream = newStreamHub()
+	a.limits = newRateLimiters(RateLimits{})
+	a.corsPolicy = CORSPolicy{
+		MaxAge: 10 * time.Minute,
 	}
 
 	return a
 }
 
-// Start starts the API, listening on all routes
+// SetSessionIDs changes the generator session IDs come from. By default, it's a generator
+// with a random node.
+func (a *API) SetSessionIDs(g *sessionid.Generator) {
+	a.ids = g
+}
+
+// SetSink changes where session records are written to every time they change.
+// By default, they're written as a table to stdout.
+func (a *API) SetSink(s sink.Sink) {
+	a.sink = s
+}
+
+// Start starts the API, listening on all routes.
+// It returns http.ErrServerClosed once Shutdown is called.
 func (a *API) Start() error {
 	return a.srv.ListenAndServe()
 }
 
-func (a *API) writeOptions(w http.ResponseWriter) {
-	a.setCorsHeaders(w)
-	w.Header().Add("Content-Type", "application/json")
+// Shutdown stops the API gracefully: it stops accepting requests, ends any streams, waits for
+// in-flight requests to finish (or ctx to be done), then writes every live session to the sink
+// one last time and closes it. Sessions are only flushed once nothing can change them anymore.
+func (a *API) Shutdown(ctx context.Context) error {
+	if a.stopReaper != nil {
+		a.stopReaper()
+	}
+	a.stream.close()
+
+	err := a.srv.Shutdown(ctx)
+	if err != nil {
+		log.Println("Failed to drain in-flight requests | Error:", err)
+	}
+
+	flushErr := a.flush()
+	if err == nil {
+		err = flushErr
+	}
 
-	w.WriteHeader(http.StatusOK)
+	closeErr := a.sink.Close()
+	if err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func (a *API) setCorsHeaders(w http.ResponseWriter) {
-	w.Header().Add("Access-Control-Allow-Origin", "*") // Don't do this in prod lol
-	w.Header().Add("Access-Control-Allow-Headers", "Content-Type")
-	w.Header().Add("Access-Control-Allow-Methods", "OPTIONS, POST")
+// flush writes every session that hasn't finished yet to the sink.
+func (a *API) flush() error {
+	live, err := data.Ds.List(data.Query{
+		States: []data.State{data.StateCreated, data.StateInProgress},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range live {
+		err := a.sink.Write(d)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Flushed %v live sessions", len(live))
+	return nil
 }
 
 func (a *API) handleNewSession(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodOptions {
-		a.writeOptions(w)
-		return
-	}
 	if r.Method != http.MethodPost {
 		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
 		return
 	}
-	a.setCorsHeaders(w)
 	w.Header().Add("Content-Type", "application/json")
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
@@ -108,20 +190,38 @@ func (a *API) handleNewSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	err = a.authenticate(r, nsr.WebsiteURL)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	ok, retryAfter := a.allow(rateLimitWebsite, nsr.WebsiteURL)
+	if !ok {
+		writeRateLimited(w, retryAfter)
+		return
+	}
+
 	// Create and store data object
-	sessionID := a.generateSessionID()
-	if sessionID == "" {
-		log.Printf("Couldn't generate a session ID for user in %v. Timed-out", nsr.WebsiteURL)
+	sessionID, err := a.ids.New()
+	if err != nil {
+		log.Printf("Couldn't generate a session ID for user in %v | Error: %v", nsr.WebsiteURL, err)
 		http.Error(w, errInternalServer, http.StatusInternalServerError)
 		return
 	}
 
-	d := data.New(nsr.WebsiteURL, sessionID)
-	log.Printf("Data @ handleNewSession\n%#+v", d)
+	d, err := data.New(nsr.WebsiteURL, sessionID)
+	if err != nil {
+		log.Printf("Couldn't store new session for user in %v | Error: %v", nsr.WebsiteURL, err)
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+	a.output(d)
 	log.Printf("Hash of %v: %v", d.WebsiteURL, hash.New(d.WebsiteURL))
 
 	resp := newSessionResponse{
 		SessionID: d.SessionID,
+		Token:     a.issueToken(d.WebsiteURL, d.SessionID),
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -139,16 +239,30 @@ func (a *API) handleNewSession(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (a *API) handleResizeEvent(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodOptions {
-		a.writeOptions(w)
-		return
+// handleEvent is the single entrypoint for every event type. It dispatches on the
+// `eventType` field of the body using the event registry.
+func (a *API) handleEvent(w http.ResponseWriter, r *http.Request) {
+	a.ingestEvent(w, r, "", true)
+}
+
+// handleEventOfType returns a handler that decodes every request as the given event type.
+// It keeps the old per-event routes working for clients that haven't moved to /events yet.
+// Those clients predate session tokens too, so these routes don't ask for one.
+func (a *API) handleEventOfType(eventType string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a.ingestEvent(w, r, eventType, false)
 	}
+}
+
+// ingestEvent reads, decodes, validates and applies an event to its session.
+// If eventType is empty, the type is taken from the request body. If needToken is set, the event
+// has to carry its session's token (when we issue them).
+func (a *API) ingestEvent(w http.ResponseWriter, r *http.Request, eventType string, needToken bool) {
+	receivedAt := time.Now()
 	if r.Method != http.MethodPost {
 		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
 		return
 	}
-	a.setCorsHeaders(w)
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -157,179 +271,95 @@ func (a *API) handleResizeEvent(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	var rpe resizePageEvent
-	err = json.Unmarshal(bodyBytes, &rpe)
-	if err != nil {
-		log.Println("Failed to unmarshal JSON to struct | Error:", err)
-		http.Error(w, errIncorrectJSON, http.StatusBadRequest)
-		return
-	}
-
-	valid, err := rpe.Valid()
-	if err != nil {
-		log.Println("Failed to determine if request was valid (issues w/ datastore) | Error:", err)
-		http.Error(w, errInternalServer, http.StatusInternalServerError)
-		return
+	var ev event
+	if eventType == "" {
+		ev, err = a.events.decode(bodyBytes)
+	} else {
+		ev, err = a.events.decodeAs(eventType, bodyBytes)
 	}
-	if !valid {
-		http.Error(w, errInvalidRequest, http.StatusBadRequest)
+	if err == errUnknownEventType {
+		http.Error(w, errInvalidEventType, http.StatusBadRequest)
 		return
 	}
-
-	d := &data.Data{
-		ResizeFrom: rpe.ResizeFrom,
-		ResizeTo:   rpe.ResizeTo,
-	}
-
-	newData, err := data.Ds.Mutate(rpe.WebsiteURL, rpe.SessionID, d)
 	if err != nil {
-		log.Println("Error mutating data | Error:", err)
-		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		log.Println("Failed to unmarshal JSON to struct | Error:", err)
+		http.Error(w, errIncorrectJSON, http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Data @ handleResizeEvent\n%#+v", newData)
-}
-
-func (a *API) handleCopyPasteEvent(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodOptions {
-		a.writeOptions(w)
-		return
-	}
-	if r.Method != http.MethodPost {
-		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
-		return
+	if re, ok := ev.(receivedEvent); ok {
+		re.setReceivedAt(receivedAt)
 	}
 
-	a.setCorsHeaders(w)
-
-	bodyBytes, err := ioutil.ReadAll(r.Body)
+	websiteURL, sessionID := ev.Key()
+	err = a.authenticate(r, websiteURL)
 	if err != nil {
-		http.Error(w, errReadRequestBody, http.StatusBadRequest)
+		writeAuthError(w, err)
 		return
 	}
-	defer r.Body.Close()
 
-	var cpe copyPasteEvent
-	err = json.Unmarshal(bodyBytes, &cpe)
-	if err != nil {
-		log.Println("Failed to unmarshal JSON to struct | Error:", err)
-		http.Error(w, errIncorrectJSON, http.StatusBadRequest)
-		return
+	// A forged token shouldn't be able to use up the session's events
+	if needToken {
+		err = a.verifyToken(r.Header.Get(token.Header), websiteURL, sessionID)
+		if err != nil {
+			writeTokenError(w, err)
+			return
+		}
 	}
 
-	valid, err := cpe.Valid()
-	if err != nil {
-		log.Println("Failed to determine if request was valid (issues w/ datastore) | Error:", err)
-		http.Error(w, errInternalServer, http.StatusInternalServerError)
+	ok, retryAfter := a.allowEvent(websiteURL, sessionID)
+	if !ok {
+		writeRateLimited(w, retryAfter)
 		return
 	}
-	if !valid {
+
+	newData, err := a.applyEvent(ev)
+	if err == errEventNotValid {
 		http.Error(w, errInvalidRequest, http.StatusBadRequest)
 		return
 	}
-
-	d := &data.Data{
-		CopyAndPaste: map[string]bool{
-			cpe.InputID: true,
-		},
+	if err == data.ErrSessionFinished {
+		http.Error(w, errSessionFinished, http.StatusConflict)
+		return
 	}
-
-	newData, err := data.Ds.Mutate(cpe.WebsiteURL, cpe.SessionID, d)
 	if err != nil {
-		log.Println("Error mutating data | Error:", err)
+		log.Println("Failed to apply event | Error:", err)
 		http.Error(w, errInternalServer, http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Data @ handleCopyPasteEvent\n%#+v", newData)
+	a.output(newData)
 }
 
-func (a *API) handleTimeTakenEvent(w http.ResponseWriter, r *http.Request) {
-	if r.Method == http.MethodOptions {
-		a.writeOptions(w)
-		return
-	}
-	if r.Method != http.MethodPost {
-		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
-		return
-	}
-	a.setCorsHeaders(w)
-
-	bodyBytes, err := ioutil.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, errReadRequestBody, http.StatusBadRequest)
-		return
-	}
-	defer r.Body.Close()
-
-	var tte timeTakenEvent
-	err = json.Unmarshal(bodyBytes, &tte)
+// output writes a session record to the sink, and pushes it to any /stream subscribers.
+func (a *API) output(d *data.Data) {
+	err := a.sink.Write(d)
 	if err != nil {
-		log.Println("Failed to unmarshal JSON to struct | Error:", err)
-		http.Error(w, errIncorrectJSON, http.StatusBadRequest)
-		return
+		log.Println("Failed to write session to sink | Error:", err)
 	}
+	a.stream.publish(d)
+}
 
-	valid, err := tte.Valid()
+// applyEvent validates an event and merges it into its session, returning the updated data.
+// It's shared by the single and batched event endpoints.
+func (a *API) applyEvent(ev event) (*data.Data, error) {
+	valid, err := ev.Valid()
 	if err != nil {
-		log.Println("Failed to determine if request was valid (issues w/ datastore) | Error:", err)
-		http.Error(w, errInternalServer, http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 	if !valid {
-		http.Error(w, errInvalidRequest, http.StatusBadRequest)
-		return
-	}
-
-	d := &data.Data{
-		FormCompletionTime: tte.TimeTaken,
-	}
-
-	newData, err := data.Ds.Mutate(tte.WebsiteURL, tte.SessionID, d)
-	if err != nil {
-		log.Println("Error mutating data | Error:", err)
-		http.Error(w, errInternalServer, http.StatusInternalServerError)
-		return
+		return nil, errEventNotValid
 	}
 
-	log.Printf("Data @ handleTimeTakenEvent\n%#+v", newData)
-}
-
-func (a *API) generateSessionID() string {
-	// Admittedly this is not great, however:
-	// Since session IDs are also bounded by the website, I think we can get away with this
-	// (in terms of uniqueness).
-	//
-	// Since I cannot use external libraries, the options I thought of are:
-	// 1. Having an atomically incremented int64 counter;
-	// 2. Create something like a K-Sortable ID library;
-	// 3. Keep a store of all the used sessions and just use rand.Int63.
-	//
-	// Regarding 1., we wouldn't have any collisions but then we'd be permanently stuck
-	// to 2^63-1 sessions unless we reset the counter at some arbitrary point, and that sounds not very pleasant.
-	//
-	// Regarding 2., frankly I'm not too strong on crypto so it'd just too time-consuming.
-	//
-	// I chose to go with 3. because, even though it may generate collisions, it only really starts becoming
-	// an issue when we've generated over 3.3 billion sessions or so, which is when the probability raises
-	// to 25% (assuming Go's rand is not biased and each number has the same probability of being picked)
-	// It also has the same problem as 1. does, however since we have control over how we calculate the actual value,
-	// we can add more uniqueness over time. We also know when a session is finished so we could theoretically free it to be used
-	// again, but our "primary keys" are website url and session ID, so if we did that there'd be a chance that data
-	// could be replaced _if_ a user goes into the same website _and_ gets the same session ID, which is highly unlikely but
-	// I didn't want to take that risk. We could add more uniqueness by, say, integrating the user's IP into the mix.
-	//
-	// The downside to this approach is that, say there's a lot of traffic (again, we're talking billions of accrued users),
-	// this loop could start running for a long time until it finds a suitable sessionID.
-	// Mathematically speaking, there's also a point where this loop would run forever (when the probability of collision is ~75% or so, so I've added
-	// a time-out to cover that. Also, who wants to wait that long for a sessionID?
-	for start := time.Now(); time.Since(start) < 5*time.Second; {
-		sessionID := strconv.FormatInt(a.rand.Int63(), 10)
-		if ok := a.sg.Get(sessionID); !ok {
-			a.sg.Set(sessionID)
-			return sessionID
+	websiteURL, sessionID := ev.Key()
+	m := ev.Mutation()
+	return data.Ds.Mutate(websiteURL, sessionID, func(d *data.Data) error {
+		err := m(d)
+		if err != nil {
+			return err
 		}
-	}
-	return ""
+		// Any event means the visitor is doing something
+		d.Advance(data.StateInProgress)
+		return nil
+	})
 }
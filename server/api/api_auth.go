@@ -0,0 +1,124 @@
+package api
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/hash"
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
+)
+
+// SetSites sets the registry of onboarded websites. Once it's set, new sessions and events are
+// only accepted with the site key of the website they're for, from one of its allowed origins.
+// Without it, anyone can send anything.
+func (a *API) SetSites(r *site.Registry) {
+	a.sites = r
+}
+
+// authenticate checks that the request is allowed to create sessions or send events for websiteURL.
+func (a *API) authenticate(r *http.Request, websiteURL string) error {
+	if a.sites == nil {
+		return nil
+	}
+
+	_, err := a.sites.Authenticate(r.Header.Get(site.KeyHeader), r.Header.Get("Origin"), websiteURL)
+	if err != nil {
+		log.Printf("Rejected request for %v from %v | Error: %v", websiteURL, r.Header.Get("Origin"), err)
+	}
+	return err
+}
+
+func writeAuthError(w http.ResponseWriter, err error) {
+	if err == site.ErrUnknownKey {
+		http.Error(w, errUnknownSiteKey, http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, errSiteNotAllowed, http.StatusForbidden)
+}
+
+// SetTokenSigner makes /new_session hand out a signed token along with the session ID, and the
+// event endpoints require it (in token.Header), so nobody can send events to someone else's session.
+// The old per-event routes don't, as their clients never got one (see handleEventOfType).
+// Without it, knowing a session ID is enough.
+func (a *API) SetTokenSigner(s *token.Signer) {
+	a.tokens = s
+}
+
+func (a *API) issueToken(websiteURL, sessionID string) string {
+	if a.tokens == nil {
+		return ""
+	}
+
+	return a.tokens.Sign(token.Claims{
+		SessionID:      sessionID,
+		WebsiteURLHash: hash.New(websiteURL),
+		IssuedAt:       time.Now(),
+	})
+}
+
+// verifyToken checks that tok is a token for the given session. It doesn't need the datastore,
+// so bogus events are turned away before they get anywhere near it.
+func (a *API) verifyToken(tok string, websiteURL, sessionID string) error {
+	if a.tokens == nil {
+		return nil
+	}
+
+	c, err := a.tokens.Verify(tok, time.Now())
+	if err != nil {
+		return err
+	}
+	if c.SessionID != sessionID || c.WebsiteURLHash != hash.New(websiteURL) {
+		return token.ErrInvalid
+	}
+	return nil
+}
+
+func writeTokenError(w http.ResponseWriter, err error) {
+	if err == token.ErrExpired {
+		http.Error(w, errExpiredToken, http.StatusUnauthorized)
+		return
+	}
+	http.Error(w, errInvalidToken, http.StatusUnauthorized)
+}
+
+// adminKeyHeader is where the admin key goes, for the routes that show everyone's sessions.
+const adminKeyHeader = "X-Admin-Key"
+
+// Browsers can't set headers on an EventSource, so for them the admin key can go in a cookie
+// or, failing that, the query string instead.
+const (
+	adminKeyCookie = "admin_key"
+	adminKeyParam  = "adminKey"
+)
+
+// SetAdminKey sets the key the admin routes (reading sessions, the live stream and /debug/vars)
+// require in the X-Admin-Key header. Without it, they're off: nobody can use them.
+func (a *API) SetAdminKey(key string) {
+	a.adminKey = key
+}
+
+// requireAdmin only lets requests with the admin key through to next.
+func (a *API) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := adminKeyOf(r)
+		if a.adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(a.adminKey)) != 1 {
+			http.Error(w, errAdminKeyRequired, http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// adminKeyOf returns the admin key r was sent with, from wherever it was put.
+func adminKeyOf(r *http.Request) string {
+	if key := r.Header.Get(adminKeyHeader); key != "" {
+		return key
+	}
+	if c, err := r.Cookie(adminKeyCookie); err == nil && c.Value != "" {
+		return c.Value
+	}
+	return r.URL.Query().Get(adminKeyParam)
+}
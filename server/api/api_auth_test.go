@@ -0,0 +1,212 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+	"github.com/hugoamvieira/code-test/server/ratelimit"
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthentication(t *testing.T) {
+	Convey("Given an API with an onboarded website", t, func() {
+		a := New(":0")
+		reg, err := site.NewRegistry([]site.Site{{Key: "siteKey16", WebsiteURL: "https://www.website16.com"}})
+		So(err, ShouldBeNil)
+		a.SetSites(reg)
+
+		post := func(path, body, key, origin string) int {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if key != "" {
+				req.Header.Set(site.KeyHeader, key)
+			}
+			if origin != "" {
+				req.Header.Set("Origin", origin)
+			}
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+		newSession := `{"websiteURL":"https://www.website16.com/checkout"}`
+
+		Convey("creating a session with its key, from its origin, should work", func() {
+			So(post("/new_session", newSession, "siteKey16", "https://www.website16.com"), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("creating a session without a valid key should be unauthorized", func() {
+			So(post("/new_session", newSession, "", "https://www.website16.com"), ShouldEqual, http.StatusUnauthorized)
+			So(post("/new_session", newSession, "nope", "https://www.website16.com"), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("creating a session from another origin or for another website should be forbidden", func() {
+			So(post("/new_session", newSession, "siteKey16", "https://evil.com"), ShouldEqual, http.StatusForbidden)
+			So(post("/new_session", `{"websiteURL":"https://evil.com"}`, "siteKey16", "https://www.website16.com"), ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("events for another website should be rejected", func() {
+			body := `{"eventType":"copyAndPaste","websiteURL":"https://evil.com","sessionID":"s","inputID":"i"}`
+			So(post("/events", body, "siteKey16", "https://www.website16.com"), ShouldEqual, http.StatusForbidden)
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader("["+body+"]"))
+			req.Header.Set(site.KeyHeader, "siteKey16")
+			req.Header.Set("Origin", "https://www.website16.com")
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldContainSubstring, `"accepted":false`)
+		})
+	})
+}
+
+func TestSessionTokens(t *testing.T) {
+	Convey("Given an API that issues session tokens", t, func() {
+		a := New(":0")
+		a.SetTokenSigner(token.NewSigner([]byte("key"), time.Hour))
+
+		post := func(path, body, tok string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			if tok != "" {
+				req.Header.Set(token.Header, tok)
+			}
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		rec := post("/new_session", `{"websiteURL":"https://www.website20.com"}`, "")
+		So(rec.Code, ShouldEqual, http.StatusOK)
+		var resp newSessionResponse
+		So(json.Unmarshal(rec.Body.Bytes(), &resp), ShouldBeNil)
+		So(resp.Token, ShouldNotBeEmpty)
+
+		event := func(websiteURL, sessionID string) string {
+			return `{"eventType":"copyAndPaste","websiteURL":"` + websiteURL + `","sessionID":"` + sessionID + `","inputID":"inputCVV"}`
+		}
+
+		Convey("events for its session should be accepted with its token", func() {
+			So(post("/events", event("https://www.website20.com", resp.SessionID), resp.Token).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("events without a token, or with a bad one, should be unauthorized", func() {
+			So(post("/events", event("https://www.website20.com", resp.SessionID), "").Code, ShouldEqual, http.StatusUnauthorized)
+			So(post("/events", event("https://www.website20.com", resp.SessionID), resp.Token+"x").Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("events on the old per-event routes shouldn't need a token", func() {
+			So(post("/new_cp_event", event("https://www.website20.com", resp.SessionID), "").Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("its token shouldn't work for other sessions or websites", func() {
+			other, err := data.New("https://www.website21.com", resp.SessionID)
+			So(err, ShouldBeNil)
+			So(post("/events", event(other.WebsiteURL, other.SessionID), resp.Token).Code, ShouldEqual, http.StatusUnauthorized)
+
+			_, err = data.New("https://www.website20.com", "otherSession20")
+			So(err, ShouldBeNil)
+			rec := post("/events/batch", "["+event("https://www.website20.com", "otherSession20")+"]", resp.Token)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			So(rec.Body.String(), ShouldContainSubstring, errorMessage(errInvalidToken))
+		})
+
+		Convey("a batch for many sessions should be accepted with each event's own token", func() {
+			rec := post("/new_session", `{"websiteURL":"https://www.website20.com"}`, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			var other newSessionResponse
+			So(json.Unmarshal(rec.Body.Bytes(), &other), ShouldBeNil)
+
+			withToken := func(ev, tok string) string {
+				return strings.TrimSuffix(ev, "}") + `,"token":"` + tok + `"}`
+			}
+			batch := "[" + withToken(event("https://www.website20.com", resp.SessionID), resp.Token) + "," +
+				withToken(event("https://www.website20.com", other.SessionID), other.Token) + "," +
+				withToken(event("https://www.website20.com", other.SessionID), resp.Token) + "]"
+
+			rec = post("/events/batch", batch, "")
+			So(rec.Code, ShouldEqual, http.StatusOK)
+			var br batchEventResponse
+			So(json.Unmarshal(rec.Body.Bytes(), &br), ShouldBeNil)
+			So(br.Results[0].Accepted, ShouldBeTrue)
+			So(br.Results[1].Accepted, ShouldBeTrue)
+			So(br.Results[2].Accepted, ShouldBeFalse)
+			So(br.Results[2].Error, ShouldEqual, errorMessage(errInvalidToken))
+		})
+
+		Convey("events with a bad token shouldn't use up the session's rate limit", func() {
+			a.SetRateLimits(RateLimits{Session: ratelimit.Limit{Rate: 0.001, Burst: 1}})
+			for i := 0; i < 3; i++ {
+				So(post("/events", event("https://www.website20.com", resp.SessionID), resp.Token+"x").Code, ShouldEqual, http.StatusUnauthorized)
+			}
+			So(post("/events/batch", "["+event("https://www.website20.com", resp.SessionID)+"]", resp.Token+"x").Body.String(), ShouldContainSubstring, errorMessage(errInvalidToken))
+
+			So(post("/events", event("https://www.website20.com", resp.SessionID), resp.Token).Code, ShouldEqual, http.StatusOK)
+		})
+
+		Convey("an expired token should be rejected", func() {
+			old := token.NewSigner([]byte("key"), time.Hour).Sign(token.Claims{
+				SessionID:      resp.SessionID,
+				WebsiteURLHash: hash.New("https://www.website20.com"),
+				IssuedAt:       time.Now().Add(-2 * time.Hour),
+			})
+			rec := post("/events", event("https://www.website20.com", resp.SessionID), old)
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+			So(rec.Body.String(), ShouldContainSubstring, "expired")
+		})
+	})
+}
+
+func TestAdminKey(t *testing.T) {
+	Convey("Given an API with an admin key", t, func() {
+		a := New(":0")
+		a.SetAdminKey("admin")
+
+		get := func(path string, key string) int {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			if key != "" {
+				req.Header.Set(adminKeyHeader, key)
+			}
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		Convey("the admin routes should need it", func() {
+			for _, path := range []string{"/sessions", "/sessions/https:%2F%2Fwww.website.com/1234", "/debug/vars"} {
+				So(get(path, ""), ShouldEqual, http.StatusUnauthorized)
+				So(get(path, "nope"), ShouldEqual, http.StatusUnauthorized)
+			}
+			So(get("/sessions", "admin"), ShouldEqual, http.StatusOK)
+			So(get("/debug/vars", "admin"), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("it should also be taken from a cookie or the query string", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			req.AddCookie(&http.Cookie{Name: adminKeyCookie, Value: "admin"})
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			So(get("/sessions?"+adminKeyParam+"=admin", ""), ShouldEqual, http.StatusOK)
+			So(get("/sessions?"+adminKeyParam+"=nope", ""), ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+
+	Convey("Given an API without an admin key", t, func() {
+		a := New(":0")
+
+		Convey("the admin routes should be off", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
+)
+
+const (
+	corsAllowedMethods = "GET, POST, OPTIONS"
+	corsAllowAnyOrigin = "*"
+)
+
+var corsAllowedHeaders = strings.Join([]string{"Content-Type", site.KeyHeader, token.Header, adminKeyHeader}, ", ")
+
+// CORSPolicy is how the API answers cross-origin requests.
+// Origins are allowed if they're in AllowedOrigins or are allowed by an onboarded website (see SetSites).
+// If a request carries a site key, only that website's origins are allowed.
+// If there are no AllowedOrigins and no onboarded websites, every origin is allowed, which is only
+// good enough for development.
+type CORSPolicy struct {
+	// AllowedOrigins are allowed on top of the onboarded websites' origins. "*" allows every origin.
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send cookies along with cross-origin requests. It only
+	// applies to origins that are allowed by name: browsers won't send credentials to "*",
+	// and we don't get around that by echoing whatever origin came along.
+	AllowCredentials bool
+	// MaxAge is how long browsers can cache the answer to a preflight request for.
+	MaxAge time.Duration
+}
+
+// SetCORSPolicy changes how the API answers cross-origin requests.
+func (a *API) SetCORSPolicy(p CORSPolicy) {
+	a.corsPolicy = p
+}
+
+// AllowsAnyOrigin tells whether the policy lets every origin in, either with "*" or because
+// there's nothing to go by (no allowed origins, and no onboarded websites if there are none).
+func (p CORSPolicy) AllowsAnyOrigin(haveSites bool) bool {
+	for _, o := range p.AllowedOrigins {
+		if o == corsAllowAnyOrigin {
+			return true
+		}
+	}
+	return len(p.AllowedOrigins) == 0 && !haveSites
+}
+
+// originAllowed tells whether origin is allowed, and whether it was allowed by name (as opposed
+// to because any origin is).
+func (a *API) originAllowed(r *http.Request, origin string) (allowed bool, named bool) {
+	if key := r.Header.Get(site.KeyHeader); key != "" && a.sites != nil {
+		s, ok := a.sites.Get(key)
+		if ok {
+			allowed = s.AllowsOrigin(origin)
+			return allowed, allowed
+		}
+	}
+
+	for _, o := range a.corsPolicy.AllowedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true, true
+		}
+	}
+	if a.sites != nil && a.sites.AllowsOrigin(origin) {
+		return true, true
+	}
+	return a.corsPolicy.AllowsAnyOrigin(a.sites != nil), false
+}
+
+// cors applies the CORS policy to every request, answering preflight requests itself so that
+// handlers only ever see the actual requests.
+func (a *API) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The answer depends on the origin, so caches must not hand it to other origins.
+		w.Header().Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" {
+			// Not a cross-origin request.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowed, named := a.originAllowed(r, origin)
+		if !allowed {
+			if preflight {
+				http.Error(w, errOriginNotAllowed, http.StatusForbidden)
+				return
+			}
+			// Without the CORS headers, the browser won't let the page read the response.
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if a.corsPolicy.AllowCredentials && named {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", corsAllowedMethods)
+		w.Header().Set("Access-Control-Allow-Headers", corsAllowedHeaders)
+		if a.corsPolicy.MaxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(a.corsPolicy.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
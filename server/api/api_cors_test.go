@@ -0,0 +1,119 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/site"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCORS(t *testing.T) {
+	Convey("Given an API with an onboarded website", t, func() {
+		a := New(":0")
+		reg, err := site.NewRegistry([]site.Site{
+			{Key: "siteKey17", WebsiteURL: "https://www.website17.com"},
+			{Key: "siteKey18", WebsiteURL: "https://www.website18.com"},
+		})
+		So(err, ShouldBeNil)
+		a.SetSites(reg)
+		a.SetCORSPolicy(CORSPolicy{AllowCredentials: true, MaxAge: time.Minute})
+
+		preflight := func(origin string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodOptions, "/events", nil)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("a preflight from its origin should be allowed and cacheable", func() {
+			rec := preflight("https://www.website17.com")
+			So(rec.Code, ShouldEqual, http.StatusNoContent)
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://www.website17.com")
+			So(rec.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+			So(rec.Header().Get("Access-Control-Allow-Headers"), ShouldContainSubstring, site.KeyHeader)
+			So(rec.Header().Get("Access-Control-Allow-Headers"), ShouldContainSubstring, adminKeyHeader)
+			So(rec.Header().Get("Access-Control-Max-Age"), ShouldEqual, "60")
+			So(rec.Header()["Vary"], ShouldContain, "Origin")
+		})
+
+		Convey("a preflight from another origin should be forbidden", func() {
+			rec := preflight("https://evil.com")
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+		})
+
+		Convey("a request with a site key should only be allowed from that site's origins", func() {
+			req := httptest.NewRequest(http.MethodPost, "/new_session", strings.NewReader(`{"websiteURL":"https://www.website17.com"}`))
+			req.Header.Set("Origin", "https://www.website18.com")
+			req.Header.Set(site.KeyHeader, "siteKey17")
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldBeEmpty)
+			So(rec.Header()["Vary"], ShouldContain, "Origin")
+			So(rec.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("extra allowed origins should be allowed too", func() {
+			a.SetCORSPolicy(CORSPolicy{AllowedOrigins: []string{"https://dashboard.internal"}})
+			rec := preflight("https://dashboard.internal")
+			So(rec.Code, ShouldEqual, http.StatusNoContent)
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://dashboard.internal")
+			So(rec.Header().Get("Access-Control-Allow-Credentials"), ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an API that allows any origin, with credentials", t, func() {
+		a := New(":0")
+		a.SetCORSPolicy(CORSPolicy{AllowedOrigins: []string{"https://dashboard.internal", "*"}, AllowCredentials: true})
+
+		preflight := func(origin string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodOptions, "/events", nil)
+			req.Header.Set("Origin", origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("only origins allowed by name should get credentials", func() {
+			rec := preflight("https://evil.com")
+			So(rec.Code, ShouldEqual, http.StatusNoContent)
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "https://evil.com")
+			So(rec.Header().Get("Access-Control-Allow-Credentials"), ShouldBeEmpty)
+
+			rec = preflight("https://dashboard.internal")
+			So(rec.Header().Get("Access-Control-Allow-Credentials"), ShouldEqual, "true")
+		})
+
+		Convey("the policy should say it allows any origin", func() {
+			So(a.corsPolicy.AllowsAnyOrigin(false), ShouldBeTrue)
+			So(CORSPolicy{}.AllowsAnyOrigin(false), ShouldBeTrue)
+			So(CORSPolicy{}.AllowsAnyOrigin(true), ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an API without any websites or allowed origins", t, func() {
+		a := New(":0")
+		a.SetCORSPolicy(CORSPolicy{AllowCredentials: true})
+
+		Convey("any origin should be allowed", func() {
+			req := httptest.NewRequest(http.MethodOptions, "/new_session", nil)
+			req.Header.Set("Origin", "http://localhost")
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+
+			So(rec.Code, ShouldEqual, http.StatusNoContent)
+			So(rec.Header().Get("Access-Control-Allow-Origin"), ShouldEqual, "http://localhost")
+			So(rec.Header().Get("Access-Control-Allow-Credentials"), ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+var (
+	errUnknownEventType = errors.New("Unknown event type")
+	errEventTypeExists  = errors.New("Event type has already been registered")
+	errEventNotValid    = errors.New("Event is not valid")
+	errInvalidParam     = errors.New("Invalid query parameter")
+)
+
+// event is what every event type has to implement in order to be ingested.
+// Valid decides if the event can be applied, Key says which session it belongs to
+// and Mutation returns how the event merges into the session. Every event moves the session
+// forward in its lifecycle too (see applyEvent), so mutations only need to do so if they finish it.
+type event interface {
+	Valid() (bool, error)
+	Key() (websiteURL string, sessionID string)
+	Mutation() data.Mutation
+}
+
+// receivedEvent is an event that needs to know when the server got it.
+type receivedEvent interface {
+	setReceivedAt(t time.Time)
+}
+
+// eventDecoder turns the raw request body into an event.
+type eventDecoder func(b []byte) (event, error)
+
+// eventEnvelope is used to peek at the type of an event before decoding the rest of it.
+type eventEnvelope struct {
+	EventType string `json:"eventType"`
+}
+
+// eventRegistry holds every event type the API knows about, keyed by the `eventType`
+// field the client sends. Adding a new behavioural signal should only require
+// declaring its struct (in api_events.go) and registering it here.
+type eventRegistry struct {
+	decoders map[string]eventDecoder
+	mu       sync.RWMutex
+}
+
+func newEventRegistry() *eventRegistry {
+	er := &eventRegistry{
+		decoders: make(map[string]eventDecoder),
+	}
+
+	er.register(eventTypeResize, jsonDecoder(func() event { return &resizePageEvent{} }))
+	er.register(eventTypeCopyPaste, jsonDecoder(func() event { return &copyPasteEvent{} }))
+	er.register(eventTypeTimeTaken, jsonDecoder(func() event { return &timeTakenEvent{} }))
+	er.register(eventTypeKeystroke, jsonDecoder(func() event { return &keystrokeEvent{} }))
+
+	return er
+}
+
+// jsonDecoder returns a decoder that unmarshals the body straight into whatever `newFn` creates.
+// This is enough for most events, but a type can declare its own decoder if it needs to.
+func jsonDecoder(newFn func() event) eventDecoder {
+	return func(b []byte) (event, error) {
+		ev := newFn()
+		err := json.Unmarshal(b, ev)
+		if err != nil {
+			return nil, err
+		}
+		return ev, nil
+	}
+}
+
+func (er *eventRegistry) register(eventType string, dec eventDecoder) error {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if _, ok := er.decoders[eventType]; ok {
+		return errEventTypeExists
+	}
+	er.decoders[eventType] = dec
+	return nil
+}
+
+// decode peeks at the `eventType` field and decodes the body with the matching decoder.
+func (er *eventRegistry) decode(b []byte) (event, error) {
+	var env eventEnvelope
+	err := json.Unmarshal(b, &env)
+	if err != nil {
+		return nil, err
+	}
+	return er.decodeAs(env.EventType, b)
+}
+
+// decodeAs decodes the body as the given event type, regardless of what the body says it is.
+func (er *eventRegistry) decodeAs(eventType string, b []byte) (event, error) {
+	er.mu.RLock()
+	dec, ok := er.decoders[eventType]
+	er.mu.RUnlock()
+
+	if !ok {
+		return nil, errUnknownEventType
+	}
+	return dec(b)
+}
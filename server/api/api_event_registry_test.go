@@ -0,0 +1,107 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestEventRegistryDecode(t *testing.T) {
+	Convey("Given the default event registry", t, func() {
+		er := newEventRegistry()
+
+		Convey("a body with a known event type should be decoded into that event", func() {
+			ev, err := er.decode([]byte(`{"eventType":"copyAndPaste","websiteURL":"https://w.com","sessionID":"s","inputID":"cardNumber"}`))
+			So(err, ShouldBeNil)
+
+			cpe, ok := ev.(*copyPasteEvent)
+			So(ok, ShouldBeTrue)
+			So(cpe.InputID, ShouldEqual, "cardNumber")
+
+			websiteURL, sessionID := ev.Key()
+			So(websiteURL, ShouldEqual, "https://w.com")
+			So(sessionID, ShouldEqual, "s")
+			So(applied(ev).CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 1)
+		})
+
+		Convey("a body with an unknown event type should fail", func() {
+			ev, err := er.decode([]byte(`{"eventType":"nope"}`))
+			So(err, ShouldEqual, errUnknownEventType)
+			So(ev, ShouldBeNil)
+		})
+
+		Convey("a malformed body should fail", func() {
+			ev, err := er.decode([]byte(`{"eventType":`))
+			So(err, ShouldNotBeNil)
+			So(ev, ShouldBeNil)
+		})
+
+		Convey("decodeAs should ignore the event type in the body", func() {
+			ev, err := er.decodeAs(eventTypeTimeTaken, []byte(`{"eventType":"windowResize","timeSeconds":10}`))
+			So(err, ShouldBeNil)
+			So(applied(ev).FormCompletionTime, ShouldEqual, 10)
+		})
+
+		Convey("registering an existing event type should fail", func() {
+			err := er.register(eventTypeResize, jsonDecoder(func() event { return &resizePageEvent{} }))
+			So(err, ShouldEqual, errEventTypeExists)
+		})
+	})
+}
+
+func TestHandleEvent(t *testing.T) {
+	Convey("For an existing session", t, func() {
+		a := New(":0")
+		d, err := data.New("https://www.website8.com", "validSession8")
+		So(err, ShouldBeNil)
+
+		Convey("posting a known event to /events should apply it", func() {
+			body := `{"eventType":"copyAndPaste","websiteURL":"https://www.website8.com","sessionID":"validSession8","inputID":"inputCVV"}`
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			stored, ok, err := data.Ds.Get(d.WebsiteURL, d.SessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(stored.CopyAndPaste["inputCVV"].Pastes, ShouldEqual, 1)
+		})
+
+		Convey("posting keystrokes to /events should add them to the session, but never the keys", func() {
+			body := `{"eventType":"keystrokes","websiteURL":"https://www.website8.com","sessionID":"validSession8","inputID":"inputName",` +
+				`"keys":[{"downAt":1000,"upAt":1100,"key":"J"},{"downAt":1250,"upAt":1300,"key":"o"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			stored, ok, err := data.Ds.Get(d.WebsiteURL, d.SessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(stored.Keystrokes["inputName"].Count, ShouldEqual, 2)
+			So(stored.Keystrokes["inputName"].InterKeyMs.Max, ShouldEqual, 250)
+
+			b, err := json.Marshal(stored)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldNotContainSubstring, `"J"`)
+		})
+
+		Convey("posting an unknown event to /events should be rejected", func() {
+			body := `{"eventType":"nope","websiteURL":"https://www.website8.com","sessionID":"validSession8"}`
+			req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/url"
+	"time"
 
 	"github.com/hugoamvieira/code-test/server/data"
 )
@@ -9,11 +10,27 @@ import (
 // Every possible event will be listed here. This is done on purpose
 // as I believe if an event is to be parsed, it must be explicitly declared here.
 // Avoids strange undocumented behaviour.
+// Each event must also be registered in the event registry (see api_event_registry.go)
+// under the same `eventType` the client sends.
+
+const (
+	eventTypeResize    = "windowResize"
+	eventTypeCopyPaste = "copyAndPaste"
+	eventTypeTimeTaken = "timeTaken"
+	eventTypeKeystroke = "keystrokes"
+)
+
+// maxPastedLength is the longest paste we believe anyone would do into a form field.
+const maxPastedLength = 1 << 20
 
 type copyPasteEvent struct {
 	WebsiteURL string `json:"websiteURL"`
 	SessionID  string `json:"sessionID"`
 	InputID    string `json:"inputID"`
+	// Action is copy, cut or paste. Older clients only ever sent pastes, without it.
+	Action        data.ClipboardAction `json:"action"`
+	PastedLength  int                  `json:"pastedLength"`
+	ReplacedValue bool                 `json:"replacedValue"`
 }
 
 func (cpe *copyPasteEvent) Valid() (bool, error) {
@@ -22,7 +39,28 @@ func (cpe *copyPasteEvent) Valid() (bool, error) {
 	if err != nil {
 		return false, err
 	}
-	return cpe.InputID != "" && ok, nil
+
+	validAction := cpe.action().Valid()
+	validLength := cpe.PastedLength >= 0 && cpe.PastedLength <= maxPastedLength
+	return cpe.InputID != "" && validAction && validLength && ok, nil
+}
+
+func (cpe *copyPasteEvent) action() data.ClipboardAction {
+	if cpe.Action == "" {
+		return data.ClipboardPaste
+	}
+	return cpe.Action
+}
+
+func (cpe *copyPasteEvent) Key() (string, string) {
+	return cpe.WebsiteURL, cpe.SessionID
+}
+
+func (cpe *copyPasteEvent) Mutation() data.Mutation {
+	return func(d *data.Data) error {
+		d.AddClipboard(cpe.InputID, data.NewCopyPaste(cpe.action(), cpe.PastedLength, cpe.ReplacedValue), time.Now())
+		return nil
+	}
 }
 
 type resizePageEvent struct {
@@ -39,17 +77,42 @@ func (rpe *resizePageEvent) Valid() (bool, error) {
 		return false, err
 	}
 
-	// Maybe validate if we can parse these into ints instead of this?
-	validResizeFrom := rpe.ResizeFrom.Width != "" && rpe.ResizeFrom.Height != ""
-	validResizeTo := rpe.ResizeTo.Width != "" && rpe.ResizeTo.Height != ""
+	return rpe.ResizeFrom.Valid() && rpe.ResizeTo.Valid() && ok, nil
+}
 
-	return validResizeTo && validResizeFrom && ok, nil
+func (rpe *resizePageEvent) Key() (string, string) {
+	return rpe.WebsiteURL, rpe.SessionID
 }
 
+func (rpe *resizePageEvent) Mutation() data.Mutation {
+	return func(d *data.Data) error {
+		d.AddResize(rpe.ResizeFrom, rpe.ResizeTo, time.Now())
+		return nil
+	}
+}
+
+// maxFieldTimings caps how many focus/blur pairs a time taken event can carry.
+const maxFieldTimings = 500
+
 type timeTakenEvent struct {
 	WebsiteURL string `json:"websiteURL"`
 	SessionID  string `json:"sessionID"`
-	TimeTaken  int    `json:"timeSeconds"` // Seconds
+	TimeTaken  int    `json:"timeSeconds"` // Seconds, rounded by older clients
+
+	// Newer clients send timestamps instead, in milliseconds since the epoch (in the client's clock).
+	FirstKeystrokeAt int64         `json:"firstKeystrokeAt"`
+	SubmitAt         int64         `json:"submitAt"`
+	SentAt           int64         `json:"sentAt"`
+	Fields           []fieldTiming `json:"fields"`
+
+	receivedAt time.Time
+}
+
+// fieldTiming is a single visit to a field: from when it got focus until it lost it.
+type fieldTiming struct {
+	InputID string `json:"inputID"`
+	FocusAt int64  `json:"focusAt"`
+	BlurAt  int64  `json:"blurAt"` // 0 if it never lost focus
 }
 
 func (tte *timeTakenEvent) Valid() (bool, error) {
@@ -59,7 +122,139 @@ func (tte *timeTakenEvent) Valid() (bool, error) {
 		return false, err
 	}
 
-	return (tte.TimeTaken > 0) && ok, nil
+	if tte.SubmitAt == 0 {
+		return (tte.TimeTaken > 0) && ok, nil
+	}
+	return tte.validTimestamps() && ok, nil
+}
+
+func (tte *timeTakenEvent) validTimestamps() bool {
+	// A form submitted in the same millisecond as its first keystroke took no time at all, which
+	// isn't a completion time we could keep
+	if tte.FirstKeystrokeAt <= 0 || tte.SubmitAt <= tte.FirstKeystrokeAt {
+		return false
+	}
+	if tte.SentAt != 0 && tte.SentAt < tte.SubmitAt {
+		return false
+	}
+	if len(tte.Fields) > maxFieldTimings {
+		return false
+	}
+	for _, f := range tte.Fields {
+		if f.InputID == "" || f.FocusAt <= 0 || (f.BlurAt != 0 && f.BlurAt < f.FocusAt) {
+			return false
+		}
+	}
+	return true
+}
+
+// setReceivedAt lets the event know when the server got it, so it can work out the clock skew.
+func (tte *timeTakenEvent) setReceivedAt(t time.Time) {
+	tte.receivedAt = t
+}
+
+func (tte *timeTakenEvent) Key() (string, string) {
+	return tte.WebsiteURL, tte.SessionID
+}
+
+func (tte *timeTakenEvent) Mutation() data.Mutation {
+	ms, timing := tte.completion()
+	return func(d *data.Data) error {
+		d.SetCompletion(ms, timing)
+		// Submitting the form is what completes a session
+		d.Advance(data.StateCompleted)
+		return nil
+	}
+}
+
+// completion returns how long the form took, in milliseconds, and when things happened
+// (in server time), if the client told us.
+func (tte *timeTakenEvent) completion() (int64, data.Timing) {
+	if tte.SubmitAt == 0 {
+		return int64(tte.TimeTaken) * 1000, data.Timing{}
+	}
+
+	receivedAt := tte.receivedAt
+	if receivedAt.IsZero() {
+		receivedAt = time.Now()
+	}
+	var skew int64
+	if tte.SentAt != 0 {
+		skew = tte.SentAt - receivedAt.UnixNano()/int64(time.Millisecond)
+	}
+
+	timing := data.Timing{
+		FirstKeystrokeAt: data.FromClockMs(tte.FirstKeystrokeAt, skew),
+		SubmittedAt:      data.FromClockMs(tte.SubmitAt, skew),
+		ReceivedAt:       receivedAt,
+		ClockSkewMs:      skew,
+	}
+	if len(tte.Fields) > 0 {
+		timing.Fields = make(map[string]data.FieldTiming)
+		for _, f := range tte.Fields {
+			var blurredAt time.Time
+			if f.BlurAt != 0 {
+				blurredAt = data.FromClockMs(f.BlurAt, skew)
+			}
+
+			ft := timing.Fields[f.InputID]
+			ft.AddFocus(data.FromClockMs(f.FocusAt, skew), blurredAt)
+			timing.Fields[f.InputID] = ft
+		}
+	}
+
+	// Both ends of it come from the client's clock, so the skew doesn't matter here.
+	return tte.SubmitAt - tte.FirstKeystrokeAt, timing
+}
+
+// maxKeystrokes caps how many keystrokes a single event can carry. The client sends them per
+// field whenever it loses focus, so this is plenty.
+const maxKeystrokes = 2000
+
+// keystrokeEvent is the typing cadence in a field. It has no key values on purpose:
+// anything else the client sends (eg: a `key`) is dropped when decoding.
+type keystrokeEvent struct {
+	WebsiteURL string           `json:"websiteURL"`
+	SessionID  string           `json:"sessionID"`
+	InputID    string           `json:"inputID"`
+	Keys       []data.Keystroke `json:"keys"`
+}
+
+func (ke *keystrokeEvent) Valid() (bool, error) {
+	// A session must already exist
+	ok, err := validURLAndSession(ke.WebsiteURL, ke.SessionID)
+	if err != nil {
+		return false, err
+	}
+
+	return ke.InputID != "" && ke.validKeys() && ok, nil
+}
+
+func (ke *keystrokeEvent) validKeys() bool {
+	if len(ke.Keys) == 0 || len(ke.Keys) > maxKeystrokes {
+		return false
+	}
+	for i, k := range ke.Keys {
+		if k.DownAt <= 0 || (k.UpAt != 0 && k.UpAt < k.DownAt) {
+			return false
+		}
+		// They have to be in order, otherwise the intervals make no sense
+		if i > 0 && k.DownAt < ke.Keys[i-1].DownAt {
+			return false
+		}
+	}
+	return true
+}
+
+func (ke *keystrokeEvent) Key() (string, string) {
+	return ke.WebsiteURL, ke.SessionID
+}
+
+func (ke *keystrokeEvent) Mutation() data.Mutation {
+	return func(d *data.Data) error {
+		d.AddKeystrokes(ke.InputID, data.NewKeystrokes(ke.Keys))
+		return nil
+	}
 }
 
 type newSessionRequest struct {
@@ -73,8 +268,9 @@ func (nsr *newSessionRequest) Valid() bool {
 	// More work would be required to make this better.
 	// Thankfully, we have a single place where we can define an event's validity!
 	// Yay for good design :P
-	_, err := url.Parse(nsr.WebsiteURL)
-	if err != nil {
+	// We do at least want it to be a full URL, so it can be matched against an onboarded site.
+	u, err := url.Parse(nsr.WebsiteURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
 		return false
 	}
 	return true
@@ -82,6 +278,8 @@ func (nsr *newSessionRequest) Valid() bool {
 
 type newSessionResponse struct {
 	SessionID string `json:"sessionID"`
+	// Token has to be sent with every event for the session, if tokens are on (see SetTokenSigner).
+	Token string `json:"token,omitempty"`
 }
 
 func validURLAndSession(url string, session string) (bool, error) {
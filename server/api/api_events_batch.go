@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
+)
+
+// maxBatchSize caps how many events a single batch can carry, so one request can't hold
+// the datastore hostage for too long.
+const maxBatchSize = 100
+
+// batchEventResult is the outcome of a single event inside a batch.
+// Index is the position of the event in the submitted array.
+type batchEventResult struct {
+	Index    int    `json:"index"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// batchEventToken is the token a batched event can carry, for batches with many sessions.
+type batchEventToken struct {
+	Token string `json:"token"`
+}
+
+type batchEventResponse struct {
+	Results []batchEventResult `json:"results"`
+}
+
+// handleEventBatch accepts a JSON array of (possibly mixed) events, for one or many sessions,
+// and applies each of them in order. Each event can carry its session's token in a `token`
+// field; events without one are checked against the token in the header. A rejected event doesn't stop the rest of the batch from
+// being applied; instead, the response says which events were accepted and which weren't.
+func (a *API) handleEventBatch(w http.ResponseWriter, r *http.Request) {
+	receivedAt := time.Now()
+	if r.Method != http.MethodPost {
+		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Add("Content-Type", "application/json")
+
+	bodyBytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, errReadRequestBody, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	var rawEvents []json.RawMessage
+	err = json.Unmarshal(bodyBytes, &rawEvents)
+	if err != nil {
+		log.Println("Failed to unmarshal JSON to struct | Error:", err)
+		http.Error(w, errIncorrectJSON, http.StatusBadRequest)
+		return
+	}
+	if len(rawEvents) > maxBatchSize {
+		http.Error(w, errBatchTooLarge, http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	resp := batchEventResponse{
+		Results: make([]batchEventResult, 0, len(rawEvents)),
+	}
+	for i, raw := range rawEvents {
+		resp.Results = append(resp.Results, a.applyBatchEvent(r, receivedAt, i, raw))
+	}
+
+	respBytes, err := json.Marshal(resp)
+	if err != nil {
+		log.Println("Failed to marshal response to JSON | Error:", err)
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	_, err = w.Write(respBytes)
+	if err != nil {
+		log.Println("Failed to write resp bytes to wire | Error:", err)
+		return
+	}
+}
+
+func (a *API) applyBatchEvent(r *http.Request, receivedAt time.Time, i int, raw json.RawMessage) batchEventResult {
+	res := batchEventResult{
+		Index: i,
+	}
+
+	ev, err := a.events.decode(raw)
+	if err == errUnknownEventType {
+		res.Error = errorMessage(errInvalidEventType)
+		return res
+	}
+	if err != nil {
+		log.Println("Failed to unmarshal batched event | Error:", err)
+		res.Error = errorMessage(errIncorrectJSON)
+		return res
+	}
+
+	if re, ok := ev.(receivedEvent); ok {
+		re.setReceivedAt(receivedAt)
+	}
+
+	websiteURL, sessionID := ev.Key()
+	tok := r.Header.Get(token.Header)
+	var bt batchEventToken
+	if json.Unmarshal(raw, &bt) == nil && bt.Token != "" {
+		tok = bt.Token
+	}
+
+	err = a.authenticate(r, websiteURL)
+	if err == site.ErrUnknownKey {
+		res.Error = errorMessage(errUnknownSiteKey)
+		return res
+	}
+	if err != nil {
+		res.Error = errorMessage(errSiteNotAllowed)
+		return res
+	}
+
+	err = a.verifyToken(tok, websiteURL, sessionID)
+	if err == token.ErrExpired {
+		res.Error = errorMessage(errExpiredToken)
+		return res
+	}
+	if err != nil {
+		res.Error = errorMessage(errInvalidToken)
+		return res
+	}
+
+	ok, _ := a.allowEvent(websiteURL, sessionID)
+	if !ok {
+		res.Error = errorMessage(errRateLimited)
+		return res
+	}
+
+	newData, err := a.applyEvent(ev)
+	if err == errEventNotValid {
+		res.Error = errorMessage(errInvalidRequest)
+		return res
+	}
+	if err == data.ErrSessionFinished {
+		res.Error = errorMessage(errSessionFinished)
+		return res
+	}
+	if err != nil {
+		log.Println("Failed to apply batched event | Error:", err)
+		res.Error = errorMessage(errInternalServer)
+		return res
+	}
+
+	a.output(newData)
+	res.Accepted = true
+	return res
+}
+
+// errorMessage returns the message in one of our JSON errors, for the results of a batch.
+func errorMessage(jsonErr string) string {
+	var e struct {
+		Error string `json:"error"`
+	}
+	err := json.Unmarshal([]byte(jsonErr), &e)
+	if err != nil {
+		return jsonErr
+	}
+	return e.Error
+}
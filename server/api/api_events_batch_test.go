@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandleEventBatch(t *testing.T) {
+	Convey("Given two existing sessions", t, func() {
+		a := New(":0")
+		d1, err := data.New("https://www.website9.com", "validSession9")
+		So(err, ShouldBeNil)
+		d2, err := data.New("https://www.website10.com", "validSession10")
+		So(err, ShouldBeNil)
+
+		Convey("a batch of mixed events should report per-event results", func() {
+			body := `[
+				{"eventType":"copyAndPaste","websiteURL":"https://www.website9.com","sessionID":"validSession9","inputID":"inputEmail"},
+				{"eventType":"windowResize","websiteURL":"https://www.website10.com","sessionID":"validSession10","resizeFrom":{"width":"1","height":"2"},"resizeTo":{"width":"3","height":"4"}},
+				{"eventType":"timeTaken","websiteURL":"https://www.website9.com","sessionID":"noSession","timeSeconds":10},
+				{"eventType":"nope"}
+			]`
+			req := httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			var resp batchEventResponse
+			err := json.Unmarshal(rec.Body.Bytes(), &resp)
+			So(err, ShouldBeNil)
+			So(len(resp.Results), ShouldEqual, 4)
+			So(resp.Results[0].Accepted, ShouldBeTrue)
+			So(resp.Results[1].Accepted, ShouldBeTrue)
+			So(resp.Results[2].Accepted, ShouldBeFalse)
+			So(resp.Results[2].Error, ShouldEqual, errorMessage(errInvalidRequest))
+			So(resp.Results[3].Accepted, ShouldBeFalse)
+			So(resp.Results[3].Error, ShouldEqual, errorMessage(errInvalidEventType))
+
+			Convey("and the accepted events should have been applied", func() {
+				stored, _, _ := data.Ds.Get(d1.WebsiteURL, d1.SessionID)
+				So(stored.CopyAndPaste["inputEmail"].Pastes, ShouldEqual, 1)
+
+				stored, _, _ = data.Ds.Get(d2.WebsiteURL, d2.SessionID)
+				So(stored.ResizeTo.Width, ShouldEqual, 3)
+			})
+		})
+
+		Convey("failed events should get the same errors as on their own", func() {
+			body := `[
+				{"eventType":"copyAndPaste","websiteURL":"https://www.website9.com","sessionID":"validSession9","inputID":5},
+				{"eventType":"timeTaken","websiteURL":"https://www.website9.com","sessionID":"validSession9","timeSeconds":10},
+				{"eventType":"copyAndPaste","websiteURL":"https://www.website9.com","sessionID":"validSession9","inputID":"inputEmail"}
+			]`
+			req := httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			var resp batchEventResponse
+			So(json.Unmarshal(rec.Body.Bytes(), &resp), ShouldBeNil)
+			So(resp.Results[0].Error, ShouldEqual, "Malformed request body")
+			So(resp.Results[1].Accepted, ShouldBeTrue)
+			So(resp.Results[2].Error, ShouldEqual, "Session has already finished")
+		})
+
+		Convey("a body that isn't an array should be rejected", func() {
+			req := httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader(`{"eventType":"timeTaken"}`))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("a batch that's too large should be rejected", func() {
+			events := make([]string, maxBatchSize+1)
+			for i := range events {
+				events[i] = `{"eventType":"nope"}`
+			}
+			body := "[" + strings.Join(events, ",") + "]"
+			req := httptest.NewRequest(http.MethodPost, "/events/batch", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusRequestEntityTooLarge)
+		})
+	})
+}
@@ -2,18 +2,27 @@ package api
 
 import (
 	"testing"
+	"time"
 
 	"github.com/hugoamvieira/code-test/server/data"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
 
+// applied returns what ev does to a brand new session.
+func applied(ev event) *data.Data {
+	d := &data.Data{}
+	ev.Mutation()(d)
+	return d
+}
+
 func TestValidForCopyPasteEvent(t *testing.T) {
 	Convey("For an existing session", t, func() {
 		websiteURL := "https://www.website1.com"
 		session := "validSession1"
 
-		d := data.New(websiteURL, session)
+		d, err := data.New(websiteURL, session)
+		So(err, ShouldBeNil)
 
 		Convey("given a valid copy-paste event", func() {
 			cpe := &copyPasteEvent{
@@ -27,6 +36,23 @@ func TestValidForCopyPasteEvent(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(valid, ShouldBeTrue)
 			})
+
+			Convey("without an action, it should be a paste", func() {
+				So(applied(cpe).CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 1)
+			})
+
+			Convey("with an unknown action or a bad pasted length, it should not be valid", func() {
+				cpe.Action = "drag"
+				valid, err := cpe.Valid()
+				So(err, ShouldBeNil)
+				So(valid, ShouldBeFalse)
+
+				cpe.Action = data.ClipboardPaste
+				cpe.PastedLength = -1
+				valid, err = cpe.Valid()
+				So(err, ShouldBeNil)
+				So(valid, ShouldBeFalse)
+			})
 		})
 	})
 
@@ -50,19 +76,20 @@ func TestValidForResizePageEvent(t *testing.T) {
 		websiteURL := "https://www.website3.com"
 		session := "validSession3"
 
-		d := data.New(websiteURL, session)
+		d, err := data.New(websiteURL, session)
+		So(err, ShouldBeNil)
 
 		Convey("given a valid resize page event", func() {
 			rpe := &resizePageEvent{
 				WebsiteURL: d.WebsiteURL,
 				SessionID:  d.SessionID,
 				ResizeFrom: data.Dimension{
-					Width:  "100",
-					Height: "200",
+					Width:  100,
+					Height: 200,
 				},
 				ResizeTo: data.Dimension{
-					Width:  "101",
-					Height: "201",
+					Width:  101,
+					Height: 201,
 				},
 			}
 
@@ -78,12 +105,12 @@ func TestValidForResizePageEvent(t *testing.T) {
 				WebsiteURL: d.WebsiteURL,
 				SessionID:  d.SessionID,
 				ResizeFrom: data.Dimension{
-					Width:  "",
-					Height: "",
+					Width:  -100,
+					Height: 200,
 				},
 				ResizeTo: data.Dimension{
-					Width:  "",
-					Height: "",
+					Width:  101,
+					Height: data.MaxDimension + 1,
 				},
 			}
 
@@ -100,12 +127,12 @@ func TestValidForResizePageEvent(t *testing.T) {
 			WebsiteURL: "https://www.website4.com",
 			SessionID:  "noSession4",
 			ResizeFrom: data.Dimension{
-				Width:  "100",
-				Height: "200",
+				Width:  100,
+				Height: 200,
 			},
 			ResizeTo: data.Dimension{
-				Width:  "101",
-				Height: "201",
+				Width:  101,
+				Height: 201,
 			},
 		}
 
@@ -122,7 +149,8 @@ func TestValidForTimeTakenEvent(t *testing.T) {
 		websiteURL := "https://www.website5.com"
 		session := "validSession5"
 
-		d := data.New(websiteURL, session)
+		d, err := data.New(websiteURL, session)
+		So(err, ShouldBeNil)
 
 		Convey("given a valid time taken event", func() {
 			tte := &timeTakenEvent{
@@ -168,6 +196,148 @@ func TestValidForTimeTakenEvent(t *testing.T) {
 	})
 }
 
+func TestTimeTakenEventTimestamps(t *testing.T) {
+	Convey("For an existing session", t, func() {
+		d, err := data.New("https://www.website23.com", "validSession23")
+		So(err, ShouldBeNil)
+		receivedAt := time.Unix(1700000010, 0)
+		// The client's clock is 2.5s ahead of ours
+		clientNow := receivedAt.UnixNano()/int64(time.Millisecond) + 2500
+
+		tte := &timeTakenEvent{
+			WebsiteURL:       d.WebsiteURL,
+			SessionID:        d.SessionID,
+			FirstKeystrokeAt: clientNow - 1750,
+			SubmitAt:         clientNow - 50,
+			SentAt:           clientNow,
+			Fields: []fieldTiming{
+				{InputID: "email", FocusAt: clientNow - 1800, BlurAt: clientNow - 1000},
+				{InputID: "email", FocusAt: clientNow - 400, BlurAt: clientNow - 100},
+				{InputID: "cardNumber", FocusAt: clientNow - 900},
+			},
+		}
+		tte.setReceivedAt(receivedAt)
+
+		Convey("it should be valid", func() {
+			valid, err := tte.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeTrue)
+		})
+
+		Convey("it should keep the completion time in milliseconds", func() {
+			dd := applied(tte)
+			So(dd.FormCompletionTimeMs, ShouldEqual, 1700)
+			So(dd.FormCompletionTime, ShouldEqual, 2)
+			So(dd.State, ShouldEqual, data.StateCompleted)
+		})
+
+		Convey("it should correct the client's timestamps by the clock skew", func() {
+			timing := applied(tte).Timing
+			So(timing.ClockSkewMs, ShouldEqual, 2500)
+			So(timing.ReceivedAt, ShouldResemble, receivedAt)
+			So(timing.SubmittedAt.Equal(receivedAt.Add(-50*time.Millisecond)), ShouldBeTrue)
+			So(timing.FirstKeystrokeAt.Equal(receivedAt.Add(-1750*time.Millisecond)), ShouldBeTrue)
+		})
+
+		Convey("it should add up the time spent in each field", func() {
+			fields := applied(tte).Timing.Fields
+			So(fields["email"].Focuses, ShouldEqual, 2)
+			So(fields["email"].FocusedMs, ShouldEqual, 1100)
+			So(fields["email"].FocusedAt.Equal(receivedAt.Add(-1800*time.Millisecond)), ShouldBeTrue)
+			So(fields["email"].BlurredAt.Equal(receivedAt.Add(-100*time.Millisecond)), ShouldBeTrue)
+			So(fields["cardNumber"].Focuses, ShouldEqual, 1)
+			So(fields["cardNumber"].BlurredAt.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("a submit before the first keystroke should not be valid", func() {
+			tte.SubmitAt = tte.FirstKeystrokeAt - 1
+			valid, err := tte.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("a submit at the same time as the first keystroke should not be valid", func() {
+			tte.SubmitAt = tte.FirstKeystrokeAt
+			valid, err := tte.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("a field that lost focus before getting it should not be valid", func() {
+			tte.Fields[0].BlurAt = tte.Fields[0].FocusAt - 1
+			valid, err := tte.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("too many fields should not be valid", func() {
+			for len(tte.Fields) <= maxFieldTimings {
+				tte.Fields = append(tte.Fields, tte.Fields[0])
+			}
+			valid, err := tte.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+	})
+}
+
+func TestValidForKeystrokeEvent(t *testing.T) {
+	Convey("For an existing session", t, func() {
+		d, err := data.New("https://www.website24.com", "validSession24")
+		So(err, ShouldBeNil)
+
+		ke := &keystrokeEvent{
+			WebsiteURL: d.WebsiteURL,
+			SessionID:  d.SessionID,
+			InputID:    "inputCardNumber",
+			Keys: []data.Keystroke{
+				{DownAt: 1000, UpAt: 1090},
+				{DownAt: 1150, UpAt: 1200, Backspace: true},
+			},
+		}
+
+		Convey("given a valid keystroke event", func() {
+			Convey("it should be valid", func() {
+				valid, err := ke.Valid()
+				So(err, ShouldBeNil)
+				So(valid, ShouldBeTrue)
+			})
+
+			Convey("it should be summarised for its field", func() {
+				k := applied(ke).Keystrokes["inputCardNumber"]
+				So(k.Count, ShouldEqual, 2)
+				So(k.Backspaces, ShouldEqual, 1)
+				So(k.InterKeyMs.Mean(), ShouldEqual, 150)
+			})
+		})
+
+		Convey("keys out of order should not be valid", func() {
+			ke.Keys[1].DownAt = 900
+			valid, err := ke.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("a key let go of before it was pressed should not be valid", func() {
+			ke.Keys[0].UpAt = 999
+			valid, err := ke.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+
+		Convey("no keys, or no field, should not be valid", func() {
+			valid, err := (&keystrokeEvent{WebsiteURL: d.WebsiteURL, SessionID: d.SessionID, InputID: "inputCVV"}).Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+
+			ke.InputID = ""
+			valid, err = ke.Valid()
+			So(err, ShouldBeNil)
+			So(valid, ShouldBeFalse)
+		})
+	})
+}
+
 func TestValidForNewSessionRequestEvent(t *testing.T) {
 	Convey("Given a valid new session request event", t, func() {
 		nsr := &newSessionRequest{
@@ -178,5 +348,11 @@ func TestValidForNewSessionRequestEvent(t *testing.T) {
 			valid := nsr.Valid()
 			So(valid, ShouldBeTrue)
 		})
+
+		Convey("without a scheme and host it should be invalid", func() {
+			nsr.WebsiteURL = "/checkout"
+			valid := nsr.Valid()
+			So(valid, ShouldBeFalse)
+		})
 	})
 }
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"expvar"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/ratelimit"
+)
+
+const (
+	rateLimitIP      = "ip"
+	rateLimitWebsite = "website"
+	rateLimitSession = "session"
+)
+
+// rateLimited counts rejected requests by what they were limited on. It's served,
+// along with the rest of the expvars, on /debug/vars.
+var rateLimited = expvar.NewMap("rateLimited")
+
+// RateLimits are the limits requests are held to. A zero limit doesn't limit anything.
+type RateLimits struct {
+	// IP limits every request, by client IP.
+	IP ratelimit.Limit
+	// Website limits new sessions and events, by website URL.
+	Website ratelimit.Limit
+	// Session limits events, by session ID.
+	Session ratelimit.Limit
+	// TrustedProxies is how many proxies (that append to X-Forwarded-For) sit in front of us.
+	// The client IP is taken from that many entries from the right of X-Forwarded-For, as
+	// anything to the left of it was sent by the client and could be made up.
+	// With 0, X-Forwarded-For is ignored.
+	TrustedProxies int
+}
+
+type rateLimiters struct {
+	limiters       map[string]*ratelimit.Limiter
+	trustedProxies int
+}
+
+func newRateLimiters(l RateLimits) *rateLimiters {
+	return &rateLimiters{
+		limiters: map[string]*ratelimit.Limiter{
+			rateLimitIP:      ratelimit.New(l.IP),
+			rateLimitWebsite: ratelimit.New(l.Website),
+			rateLimitSession: ratelimit.New(l.Session),
+		},
+		trustedProxies: l.TrustedProxies,
+	}
+}
+
+// SetRateLimits changes the limits requests are held to. By default, nothing is limited.
+func (a *API) SetRateLimits(l RateLimits) {
+	a.limits = newRateLimiters(l)
+}
+
+// allow takes a token for key from the scope's limiter, counting the rejection if there's none.
+func (a *API) allow(scope, key string) (bool, time.Duration) {
+	ok, retryAfter := a.limits.limiters[scope].Allow(key)
+	if !ok {
+		rateLimited.Add(scope, 1)
+	}
+	return ok, retryAfter
+}
+
+// allowEvent checks the website and session limits for an event.
+func (a *API) allowEvent(websiteURL, sessionID string) (bool, time.Duration) {
+	ok, retryAfter := a.allow(rateLimitWebsite, websiteURL)
+	if !ok {
+		return false, retryAfter
+	}
+	return a.allow(rateLimitSession, websiteURL+"|"+sessionID)
+}
+
+// rateLimitIP limits every request by client IP.
+func (a *API) rateLimitIP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := a.allow(rateLimitIP, a.clientIP(r))
+		if !ok {
+			writeRateLimited(w, retryAfter)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *API) clientIP(r *http.Request) string {
+	if a.limits.trustedProxies > 0 {
+		if fwd := forwardedFor(r); len(fwd) > 0 {
+			// With fewer entries than proxies, every entry came from one of them
+			i := len(fwd) - a.limits.trustedProxies
+			if i < 0 {
+				i = 0
+			}
+			return fwd[i]
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// forwardedFor returns every entry in the X-Forwarded-For headers, in order.
+func forwardedFor(r *http.Request) []string {
+	var fwd []string
+	for _, h := range r.Header["X-Forwarded-For"] {
+		for _, ip := range strings.Split(h, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				fwd = append(fwd, ip)
+			}
+		}
+	}
+	return fwd
+}
+
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	http.Error(w, errRateLimited, http.StatusTooManyRequests)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/ratelimit"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRateLimits(t *testing.T) {
+	Convey("Given an API that limits sessions to 2 events", t, func() {
+		a := New(":0")
+		a.SetRateLimits(RateLimits{Session: ratelimit.Limit{Rate: 0.001, Burst: 2}})
+		_, err := data.New("https://www.website19.com", "rateSession19")
+		So(err, ShouldBeNil)
+		body := `{"eventType":"copyAndPaste","websiteURL":"https://www.website19.com","sessionID":"rateSession19","inputID":"inputCVV"}`
+
+		post := func(path, body string) *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec
+		}
+
+		Convey("the third event should be rejected with a Retry-After", func() {
+			rejections := func() int64 {
+				v, ok := rateLimited.Get(rateLimitSession).(*expvar.Int)
+				if !ok {
+					return 0
+				}
+				return v.Value()
+			}
+			before := rejections()
+
+			So(post("/events", body).Code, ShouldEqual, http.StatusOK)
+			So(post("/events", body).Code, ShouldEqual, http.StatusOK)
+
+			rec := post("/events", body)
+			So(rec.Code, ShouldEqual, http.StatusTooManyRequests)
+			So(rec.Header().Get("Retry-After"), ShouldEqual, "1000")
+			So(rejections(), ShouldEqual, before+1)
+
+			Convey("and so should batched events", func() {
+				rec := post("/events/batch", "["+body+"]")
+				So(rec.Code, ShouldEqual, http.StatusOK)
+				So(rec.Body.String(), ShouldContainSubstring, errorMessage(errRateLimited))
+			})
+		})
+	})
+
+	Convey("Given an API behind a proxy that limits client IPs to 1 request", t, func() {
+		a := New(":0")
+		a.SetRateLimits(RateLimits{IP: ratelimit.Limit{Rate: 1, Burst: 1}, TrustedProxies: 1})
+		a.SetAdminKey("admin")
+
+		// The proxy appends the IP it got the request from to whatever the client sent
+		get := func(sent string, ip string) int {
+			req := httptest.NewRequest(http.MethodGet, "/sessions", nil)
+			req.Header.Set(adminKeyHeader, "admin")
+			fwd := ip
+			if sent != "" {
+				fwd = sent + ", " + ip
+			}
+			req.Header.Set("X-Forwarded-For", fwd)
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+			return rec.Code
+		}
+
+		Convey("a second request from the same IP should be rejected, but not from another one", func() {
+			So(get("", "1.2.3.4"), ShouldEqual, http.StatusOK)
+			So(get("", "1.2.3.4"), ShouldEqual, http.StatusTooManyRequests)
+			So(get("", "5.6.7.8"), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("a client shouldn't get around it by making up its own X-Forwarded-For", func() {
+			So(get("10.0.0.1", "1.2.3.4"), ShouldEqual, http.StatusOK)
+			So(get("10.0.0.2", "1.2.3.4"), ShouldEqual, http.StatusTooManyRequests)
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+// StartReaper runs a background goroutine that, every interval, expires sessions in the datastore
+// (see data.Expiry), so that the datastore doesn't grow forever.
+// It returns a function that stops the reaper, which Shutdown also calls.
+// A non-positive interval disables the reaper: nothing is started and the function does nothing.
+func (a *API) StartReaper(interval time.Duration, e data.Expiry) func() {
+	if interval <= 0 {
+		log.Println("Reaper disabled, sessions won't expire")
+		stop := func() {}
+		a.stopReaper = stop
+		return stop
+	}
+
+	t := time.NewTicker(interval)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case now := <-t.C:
+				a.reap(now, e)
+			case <-done:
+				t.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	stop := func() {
+		once.Do(func() {
+			close(done)
+		})
+		<-stopped
+	}
+	a.stopReaper = stop
+	return stop
+}
+
+func (a *API) reap(now time.Time, e data.Expiry) {
+	evicted, err := data.Ds.Reap(now, e)
+	if err != nil {
+		log.Println("Failed to reap sessions | Error:", err)
+		return
+	}
+
+	if len(evicted) > 0 {
+		log.Printf("Reaped %v expired sessions", len(evicted))
+	}
+}
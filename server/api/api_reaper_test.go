@@ -0,0 +1,42 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestReap(t *testing.T) {
+	Convey("Given a finished session that has expired", t, func() {
+		a := New(":0")
+
+		d, err := data.New("https://www.website11.com", "reapSession11")
+		So(err, ShouldBeNil)
+		_, err = data.Ds.Mutate(d.WebsiteURL, d.SessionID, (&timeTakenEvent{TimeTaken: 10}).Mutation())
+		So(err, ShouldBeNil)
+
+		Convey("reaping should remove it from the datastore", func() {
+			a.reap(time.Now().Add(time.Hour), data.Expiry{Completed: time.Minute})
+
+			_, ok, err := data.Ds.Get(d.WebsiteURL, d.SessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestStartReaperDisabled(t *testing.T) {
+	Convey("Starting the reaper without an interval", t, func() {
+		a := New(":0")
+
+		Convey("should leave it off, without panicking", func() {
+			var stop func()
+			So(func() { stop = a.StartReaper(0, data.Expiry{}) }, ShouldNotPanic)
+			So(stop, ShouldNotPanic)
+			So(func() { a.StartReaper(-time.Second, data.Expiry{})() }, ShouldNotPanic)
+		})
+	})
+}
@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+const (
+	defaultSessionsLimit = 50
+	maxSessionsLimit     = 500
+)
+
+type listSessionsResponse struct {
+	Sessions []*data.Data `json:"sessions"`
+	Total    int          `json:"total"`
+	// NextOffset is the offset of the next page, if there is one.
+	NextOffset *int `json:"nextOffset,omitempty"`
+}
+
+// sessionsRouter sends /sessions/... straight to get, bypassing the mux.
+// The mux would clean the escaped website URL in the path (its slashes come out as "//") and
+// redirect the request somewhere else.
+func sessionsRouter(mux http.Handler, get http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/sessions/") {
+			get.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// handleGetSession returns a single session as JSON.
+// The path is /sessions/{website}/{sessionID}, where the website URL is path-escaped
+// (eg: /sessions/https:%2F%2Fwww.website.com/1234).
+func (a *API) handleGetSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
+		return
+	}
+
+	// We need the escaped path, as the website URL has slashes of its own.
+	parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/sessions/"), "/")
+	if len(parts) != 2 {
+		http.Error(w, errInvalidRequest, http.StatusBadRequest)
+		return
+	}
+	websiteURL, err := url.PathUnescape(parts[0])
+	if err != nil {
+		http.Error(w, errInvalidRequest, http.StatusBadRequest)
+		return
+	}
+	sessionID, err := url.PathUnescape(parts[1])
+	if err != nil {
+		http.Error(w, errInvalidRequest, http.StatusBadRequest)
+		return
+	}
+
+	d, ok, err := data.Ds.Get(websiteURL, sessionID)
+	if err != nil {
+		log.Println("Failed to get session | Error:", err)
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, errSessionNonExistent, http.StatusNotFound)
+		return
+	}
+
+	a.writeJSON(w, d)
+}
+
+// handleListSessions returns the sessions matching the query string, oldest first:
+//   - website: only sessions for this website URL;
+//   - state: only sessions in these (comma-separated) states, eg: completed,abandoned;
+//   - since: only sessions updated at or after this time (RFC 3339);
+//   - limit & offset: which page of the results to return.
+func (a *API) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
+		return
+	}
+
+	q, limit, offset, err := parseSessionsQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, errInvalidQuery, http.StatusBadRequest)
+		return
+	}
+
+	sessions, err := data.Ds.List(q)
+	if err != nil {
+		log.Println("Failed to list sessions | Error:", err)
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	resp := listSessionsResponse{
+		Sessions: []*data.Data{},
+		Total:    len(sessions),
+	}
+	if offset < len(sessions) {
+		end := offset + limit
+		if end < len(sessions) {
+			resp.NextOffset = &end
+		} else {
+			end = len(sessions)
+		}
+		resp.Sessions = sessions[offset:end]
+	}
+
+	a.writeJSON(w, resp)
+}
+
+func parseSessionsQuery(v url.Values) (data.Query, int, int, error) {
+	q := data.Query{
+		WebsiteURL: v.Get("website"),
+	}
+
+	if states := v.Get("state"); states != "" {
+		for _, name := range strings.Split(states, ",") {
+			var s data.State
+			err := s.UnmarshalText([]byte(name))
+			if err != nil {
+				return q, 0, 0, err
+			}
+			q.States = append(q.States, s)
+		}
+	}
+
+	if since := v.Get("since"); since != "" {
+		t, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return q, 0, 0, err
+		}
+		q.Since = t
+	}
+
+	limit, err := parseIntParam(v, "limit", defaultSessionsLimit)
+	if err != nil || limit < 1 || limit > maxSessionsLimit {
+		return q, 0, 0, errInvalidParam
+	}
+	offset, err := parseIntParam(v, "offset", 0)
+	if err != nil || offset < 0 {
+		return q, 0, 0, errInvalidParam
+	}
+
+	return q, limit, offset, nil
+}
+
+func parseIntParam(v url.Values, name string, def int) (int, error) {
+	s := v.Get(name)
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// writeJSON writes v as the JSON response body.
+func (a *API) writeJSON(w http.ResponseWriter, v interface{}) {
+	respBytes, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Failed to marshal response to JSON | Error:", err)
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/json")
+	_, err = w.Write(respBytes)
+	if err != nil {
+		log.Println("Failed to write resp bytes to wire | Error:", err)
+	}
+}
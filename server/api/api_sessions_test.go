@@ -0,0 +1,128 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHandleGetSession(t *testing.T) {
+	Convey("For an existing session", t, func() {
+		a := New(":0")
+		a.SetAdminKey("admin")
+		d, err := data.New("https://www.website12.com", "validSession12")
+		So(err, ShouldBeNil)
+
+		Convey("getting it by its escaped website URL and session ID should return it", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions/"+url.PathEscape(d.WebsiteURL)+"/"+d.SessionID, nil)
+			req.Header.Set(adminKeyHeader, "admin")
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusOK)
+
+			var got data.Data
+			So(json.Unmarshal(rec.Body.Bytes(), &got), ShouldBeNil)
+			So(got.WebsiteURL, ShouldEqual, d.WebsiteURL)
+			So(got.SessionID, ShouldEqual, d.SessionID)
+			So(got.State, ShouldEqual, data.StateCreated)
+		})
+
+		Convey("getting a session that doesn't exist should 404", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions/"+url.PathEscape(d.WebsiteURL)+"/nope", nil)
+			req.Header.Set(adminKeyHeader, "admin")
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusNotFound)
+		})
+
+		Convey("getting it without the admin key should be unauthorized", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions/"+url.PathEscape(d.WebsiteURL)+"/"+d.SessionID, nil)
+			req.Header.Set(adminKeyHeader, "nope")
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("a path without a session ID should be rejected", func() {
+			req := httptest.NewRequest(http.MethodGet, "/sessions/"+url.PathEscape(d.WebsiteURL), nil)
+			req.Header.Set(adminKeyHeader, "admin")
+			rec := httptest.NewRecorder()
+
+			a.srv.Handler.ServeHTTP(rec, req)
+			So(rec.Code, ShouldEqual, http.StatusBadRequest)
+		})
+	})
+}
+
+func TestHandleListSessions(t *testing.T) {
+	Convey("Given a few sessions for a website", t, func() {
+		a := New(":0")
+		a.SetAdminKey("admin")
+		websiteURL := "https://www.website13.com"
+		for i := 0; i < 5; i++ {
+			_, err := data.New(websiteURL, "listSession"+strconv.Itoa(i))
+			So(err, ShouldBeNil)
+		}
+		_, err := data.Ds.Mutate(websiteURL, "listSession0", (&timeTakenEvent{TimeTaken: 10}).Mutation())
+		So(err, ShouldBeNil)
+
+		list := func(query string) (int, listSessionsResponse) {
+			req := httptest.NewRequest(http.MethodGet, "/sessions?"+query, nil)
+			req.Header.Set(adminKeyHeader, "admin")
+			rec := httptest.NewRecorder()
+			a.srv.Handler.ServeHTTP(rec, req)
+
+			var resp listSessionsResponse
+			if rec.Code == http.StatusOK {
+				So(json.Unmarshal(rec.Body.Bytes(), &resp), ShouldBeNil)
+			}
+			return rec.Code, resp
+		}
+		website := "website=" + url.QueryEscape(websiteURL)
+
+		Convey("listing them by website should return all of them", func() {
+			code, resp := list(website)
+			So(code, ShouldEqual, http.StatusOK)
+			So(resp.Total, ShouldEqual, 5)
+			So(len(resp.Sessions), ShouldEqual, 5)
+			So(resp.NextOffset, ShouldBeNil)
+		})
+
+		Convey("filtering by state should only return matching sessions", func() {
+			code, resp := list(website + "&state=completed")
+			So(code, ShouldEqual, http.StatusOK)
+			So(resp.Total, ShouldEqual, 1)
+			So(resp.Sessions[0].SessionID, ShouldEqual, "listSession0")
+		})
+
+		Convey("paging through them should hand out the next offset", func() {
+			code, resp := list(website + "&limit=2&offset=2")
+			So(code, ShouldEqual, http.StatusOK)
+			So(resp.Total, ShouldEqual, 5)
+			So(len(resp.Sessions), ShouldEqual, 2)
+			So(*resp.NextOffset, ShouldEqual, 4)
+
+			code, resp = list(website + "&limit=2&offset=4")
+			So(code, ShouldEqual, http.StatusOK)
+			So(len(resp.Sessions), ShouldEqual, 1)
+			So(resp.NextOffset, ShouldBeNil)
+		})
+
+		Convey("an invalid query should be rejected", func() {
+			for _, q := range []string{"state=nope", "since=yesterday", "limit=0", "limit=501", "offset=-1"} {
+				code, _ := list(website + "&" + q)
+				So(code, ShouldEqual, http.StatusBadRequest)
+			}
+		})
+	})
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// recordingSink keeps every record written to it.
+type recordingSink struct {
+	mu      sync.Mutex
+	written []*data.Data
+	closed  bool
+}
+
+func (s *recordingSink) Write(d *data.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.written = append(s.written, d)
+	return nil
+}
+
+func (s *recordingSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	Convey("Given a running API with a live and a finished session, and a client streaming", t, func() {
+		a := New(":0")
+		a.SetAdminKey("admin")
+		s := &recordingSink{}
+		a.SetSink(s)
+		a.StartReaper(time.Hour, data.Expiry{})
+
+		srv := httptest.NewUnstartedServer(a.srv.Handler)
+		srv.Config = a.srv
+		srv.Start()
+		defer srv.Close()
+
+		live, err := data.New("https://www.website22.com", "liveSession22")
+		So(err, ShouldBeNil)
+		finished, err := data.New("https://www.website22.com", "finishedSession22")
+		So(err, ShouldBeNil)
+		_, err = data.Ds.Mutate(finished.WebsiteURL, finished.SessionID, (&timeTakenEvent{TimeTaken: 10}).Mutation())
+		So(err, ShouldBeNil)
+
+		resp, err := getStream(srv.URL + "/stream")
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+
+		Convey("shutting it down should end the stream, flush live sessions and close the sink", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			So(a.Shutdown(ctx), ShouldBeNil)
+			So(ctx.Err(), ShouldBeNil)
+
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			So(s.closed, ShouldBeTrue)
+
+			var flushed []string
+			for _, d := range s.written {
+				if d.WebsiteURL == live.WebsiteURL {
+					flushed = append(flushed, d.SessionID)
+				}
+			}
+			So(flushed, ShouldResemble, []string{live.SessionID})
+
+			_, err := http.Get(srv.URL + "/sessions")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
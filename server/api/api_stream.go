@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+)
+
+const (
+	// streamBufferSize is how many events a subscriber can fall behind by before we start
+	// dropping events for it. A slow dashboard shouldn't slow down event ingestion.
+	streamBufferSize = 64
+
+	// streamHeartbeat is how often we send a comment down idle streams, so proxies don't
+	// close them.
+	streamHeartbeat = 15 * time.Second
+
+	streamEventMutation   = "mutation"
+	streamEventCompletion = "completion"
+)
+
+// streamFilter decides which sessions a subscriber gets. Empty fields match everything.
+type streamFilter struct {
+	websiteURL     string
+	websiteURLHash string
+}
+
+func (f streamFilter) matches(d *data.Data) bool {
+	if f.websiteURL != "" && d.WebsiteURL != f.websiteURL {
+		return false
+	}
+	if f.websiteURLHash != "" && hash.New(d.WebsiteURL) != f.websiteURLHash {
+		return false
+	}
+	return true
+}
+
+type streamSubscriber struct {
+	filter streamFilter
+	ch     chan *data.Data
+}
+
+// streamHub fans session updates out to every /stream subscriber.
+type streamHub struct {
+	mu   sync.RWMutex
+	subs map[*streamSubscriber]bool
+
+	// done is closed when the API shuts down, so streams end instead of holding the shutdown up.
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newStreamHub() *streamHub {
+	return &streamHub{
+		subs: make(map[*streamSubscriber]bool),
+		done: make(chan struct{}),
+	}
+}
+
+func (h *streamHub) close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+func (h *streamHub) subscribe(f streamFilter) *streamSubscriber {
+	s := &streamSubscriber{
+		filter: f,
+		ch:     make(chan *data.Data, streamBufferSize),
+	}
+
+	h.mu.Lock()
+	h.subs[s] = true
+	h.mu.Unlock()
+
+	return s
+}
+
+func (h *streamHub) unsubscribe(s *streamSubscriber) {
+	h.mu.Lock()
+	delete(h.subs, s)
+	h.mu.Unlock()
+}
+
+func (h *streamHub) len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs)
+}
+
+// publish hands d to every matching subscriber, without ever blocking on one.
+func (h *streamHub) publish(d *data.Data) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for s := range h.subs {
+		if !s.filter.matches(d) {
+			continue
+		}
+		select {
+		case s.ch <- d:
+		default:
+			log.Println("Stream subscriber is too slow, dropping event for session", d.SessionID)
+		}
+	}
+}
+
+// handleStream pushes every session update as a Server-Sent Event, until the client goes away.
+// It can be filtered by website with ?website=<url> or ?websiteHash=<hash of the url>.
+func (a *API) handleStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, errInvalidMethod, http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, errInternalServer, http.StatusInternalServerError)
+		return
+	}
+
+	sub := a.stream.subscribe(streamFilter{
+		websiteURL:     r.URL.Query().Get("website"),
+		websiteURLHash: r.URL.Query().Get("websiteHash"),
+	})
+	defer a.stream.unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case d := <-sub.ch:
+			err := writeStreamEvent(w, d)
+			if err != nil {
+				log.Println("Failed to write stream event | Error:", err)
+				return
+			}
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-a.stream.done:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, d *data.Data) error {
+	dataBytes, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	event := streamEventMutation
+	if d.State == data.StateCompleted {
+		event = streamEventCompletion
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, dataBytes)
+	return err
+}
@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStreamFilter(t *testing.T) {
+	Convey("Given a session", t, func() {
+		d := &data.Data{WebsiteURL: "https://www.website14.com"}
+
+		Convey("an empty filter should match it", func() {
+			So(streamFilter{}.matches(d), ShouldBeTrue)
+		})
+
+		Convey("a filter by its website URL or URL hash should match it", func() {
+			So(streamFilter{websiteURL: d.WebsiteURL}.matches(d), ShouldBeTrue)
+			So(streamFilter{websiteURLHash: hash.New(d.WebsiteURL)}.matches(d), ShouldBeTrue)
+		})
+
+		Convey("a filter by another website shouldn't match it", func() {
+			So(streamFilter{websiteURL: "https://other.com"}.matches(d), ShouldBeFalse)
+			So(streamFilter{websiteURLHash: hash.New("https://other.com")}.matches(d), ShouldBeFalse)
+		})
+	})
+}
+
+func TestHandleStream(t *testing.T) {
+	Convey("Given a client streaming a website's sessions", t, func() {
+		a := New(":0")
+		a.SetAdminKey("admin")
+		srv := httptest.NewServer(a.srv.Handler)
+		defer srv.Close()
+
+		Convey("it shouldn't be let in without the admin key", func() {
+			resp, err := http.Get(srv.URL + "/stream")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		websiteURL := "https://www.website15.com"
+		resp, err := getStream(srv.URL + "/stream?website=" + url.QueryEscape(websiteURL))
+		So(err, ShouldBeNil)
+		defer resp.Body.Close()
+		So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		So(resp.Header.Get("Content-Type"), ShouldEqual, "text/event-stream")
+		So(a.stream.len(), ShouldEqual, 1)
+
+		lines := make(chan string)
+		go func() {
+			sc := bufio.NewScanner(resp.Body)
+			for sc.Scan() {
+				lines <- sc.Text()
+			}
+			close(lines)
+		}()
+		next := func() string {
+			select {
+			case l := <-lines:
+				return l
+			case <-time.After(time.Second):
+				return ""
+			}
+		}
+
+		Convey("it should only get that website's updates, as they happen", func() {
+			a.output(&data.Data{WebsiteURL: "https://other.com", SessionID: "otherSession"})
+			a.output(&data.Data{WebsiteURL: websiteURL, SessionID: "streamSession", State: data.StateInProgress})
+			a.output(&data.Data{WebsiteURL: websiteURL, SessionID: "streamSession", State: data.StateCompleted})
+
+			So(next(), ShouldEqual, "event: mutation")
+			l := next()
+			So(strings.HasPrefix(l, "data: "), ShouldBeTrue)
+			So(l, ShouldContainSubstring, `"sessionID":"streamSession"`)
+			So(l, ShouldContainSubstring, `"state":"in-progress"`)
+			So(next(), ShouldEqual, "")
+
+			So(next(), ShouldEqual, "event: completion")
+			So(next(), ShouldContainSubstring, `"state":"completed"`)
+		})
+
+		Convey("a browser should be let in with the admin key in the query string", func() {
+			resp, err := http.Get(srv.URL + "/stream?" + adminKeyParam + "=admin")
+			So(err, ShouldBeNil)
+			resp.Body.Close()
+			So(resp.StatusCode, ShouldEqual, http.StatusOK)
+		})
+	})
+}
+
+// getStream opens a stream with the admin key the tests use.
+func getStream(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set(adminKeyHeader, "admin")
+	return http.DefaultClient.Do(req)
+}
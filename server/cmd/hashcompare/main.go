@@ -0,0 +1,41 @@
+// Command hashcompare reads URLs (one per line) from stdin and prints how many collisions
+// every registered hash algorithm has on them, so they can be compared on real data.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/hugoamvieira/code-test/server/hash"
+)
+
+func main() {
+	seen := make(map[string]bool)
+	var corpus []string
+
+	s := bufio.NewScanner(os.Stdin)
+	for s.Scan() {
+		url := s.Text()
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		corpus = append(corpus, url)
+	}
+	if err := s.Err(); err != nil {
+		log.Fatalln("Failed to read URLs | Error:", err)
+	}
+
+	fmt.Printf("%v distinct URLs\n", len(corpus))
+	for _, name := range hash.Names() {
+		h, _ := hash.Get(name)
+		c := hash.Collisions(h, corpus)
+		rate := 0.0
+		if len(corpus) > 0 {
+			rate = float64(c) / float64(len(corpus)) * 100
+		}
+		fmt.Printf("%-10v %v-bit  %8v collisions (%.4f%%)\n", name, h.Size()*8, c, rate)
+	}
+}
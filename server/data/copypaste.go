@@ -0,0 +1,95 @@
+package data
+
+import "time"
+
+// ClipboardAction is what the visitor did with the clipboard on a field.
+type ClipboardAction string
+
+// Clipboard actions
+const (
+	ClipboardCopy  ClipboardAction = "copy"
+	ClipboardCut   ClipboardAction = "cut"
+	ClipboardPaste ClipboardAction = "paste"
+)
+
+// Valid tells whether a is one of the clipboard actions.
+func (a ClipboardAction) Valid() bool {
+	return a == ClipboardCopy || a == ClipboardCut || a == ClipboardPaste
+}
+
+// CopyPaste is everything the visitor did with the clipboard on one field.
+// We never keep what was copied or pasted, only how long the pasted text was.
+type CopyPaste struct {
+	Copies        int             `json:"copies"`
+	Cuts          int             `json:"cuts"`
+	Pastes        int             `json:"pastes"`
+	FirstAt       time.Time       `json:"firstAt"`
+	LastAt        time.Time       `json:"lastAt"`
+	LastAction    ClipboardAction `json:"lastAction"`
+	PastedLength  int             `json:"pastedLength"`  // Characters in the last paste
+	ReplacedValue bool            `json:"replacedValue"` // Whether the last paste replaced the whole value of the field
+}
+
+// NewCopyPaste returns the record of a single action on a field. pastedLength and replacedValue
+// only mean something for pastes.
+func NewCopyPaste(action ClipboardAction, pastedLength int, replacedValue bool) CopyPaste {
+	c := CopyPaste{
+		LastAction: action,
+	}
+	switch action {
+	case ClipboardCopy:
+		c.Copies = 1
+	case ClipboardCut:
+		c.Cuts = 1
+	case ClipboardPaste:
+		c.Pastes = 1
+		c.PastedLength = pastedLength
+		c.ReplacedValue = replacedValue
+	}
+	return c
+}
+
+// Count returns how many clipboard actions there were on the field.
+func (c CopyPaste) Count() int {
+	return c.Copies + c.Cuts + c.Pastes
+}
+
+// AddClipboard adds what was done with the clipboard on a field to the session.
+func (d *Data) AddClipboard(inputID string, cp CopyPaste, now time.Time) {
+	// We don't have to worry about this map growing large as it (almost) directly correlates
+	// to fields that people have to put things in per website!
+	if d.CopyAndPaste == nil {
+		d.CopyAndPaste = make(map[string]CopyPaste)
+	}
+	d.CopyAndPaste[inputID] = mergeCopyPaste(d.CopyAndPaste[inputID], cp, now)
+}
+
+// mergeCopyPaste adds the actions in newCP to old. Actions without a time are taken to have
+// happened now.
+func mergeCopyPaste(old CopyPaste, newCP CopyPaste, now time.Time) CopyPaste {
+	last := newCP.LastAt
+	if last.IsZero() {
+		last = now
+	}
+	first := newCP.FirstAt
+	if first.IsZero() {
+		first = last
+	}
+
+	old.Copies += newCP.Copies
+	old.Cuts += newCP.Cuts
+	old.Pastes += newCP.Pastes
+
+	if old.FirstAt.IsZero() || first.Before(old.FirstAt) {
+		old.FirstAt = first
+	}
+	if !last.Before(old.LastAt) {
+		old.LastAt = last
+		old.LastAction = newCP.LastAction
+		if newCP.Pastes > 0 {
+			old.PastedLength = newCP.PastedLength
+			old.ReplacedValue = newCP.ReplacedValue
+		}
+	}
+	return old
+}
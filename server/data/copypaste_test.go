@@ -0,0 +1,58 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMergeCopyPaste(t *testing.T) {
+	Convey("Given a field that had a card number pasted into it", t, func() {
+		start := time.Now()
+		cp := mergeCopyPaste(CopyPaste{}, NewCopyPaste(ClipboardPaste, 16, true), start)
+
+		So(cp.Pastes, ShouldEqual, 1)
+		So(cp.FirstAt, ShouldResemble, start)
+		So(cp.LastAt, ShouldResemble, start)
+		So(cp.PastedLength, ShouldEqual, 16)
+		So(cp.ReplacedValue, ShouldBeTrue)
+
+		Convey("copying from it later should count, but keep what we know about the paste", func() {
+			cp = mergeCopyPaste(cp, NewCopyPaste(ClipboardCopy, 0, false), start.Add(time.Second))
+
+			So(cp.Count(), ShouldEqual, 2)
+			So(cp.Copies, ShouldEqual, 1)
+			So(cp.LastAction, ShouldEqual, ClipboardCopy)
+			So(cp.FirstAt, ShouldResemble, start)
+			So(cp.LastAt, ShouldResemble, start.Add(time.Second))
+			So(cp.PastedLength, ShouldEqual, 16)
+			So(cp.ReplacedValue, ShouldBeTrue)
+
+			Convey("and pasting again should replace it", func() {
+				cp = mergeCopyPaste(cp, NewCopyPaste(ClipboardPaste, 3, false), start.Add(2*time.Second))
+
+				So(cp.Pastes, ShouldEqual, 2)
+				So(cp.LastAction, ShouldEqual, ClipboardPaste)
+				So(cp.PastedLength, ShouldEqual, 3)
+				So(cp.ReplacedValue, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestAddClipboard(t *testing.T) {
+	Convey("Given a session without any clipboard actions", t, func() {
+		d := &Data{}
+
+		Convey("actions on a field should be merged, and kept apart from other fields", func() {
+			d.AddClipboard("cardNumber", NewCopyPaste(ClipboardPaste, 16, true), time.Now())
+			d.AddClipboard("cardNumber", NewCopyPaste(ClipboardPaste, 16, true), time.Now())
+			d.AddClipboard("cvv", NewCopyPaste(ClipboardCopy, 0, false), time.Now())
+
+			So(len(d.CopyAndPaste), ShouldEqual, 2)
+			So(d.CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 2)
+			So(d.CopyAndPaste["cvv"].Copies, ShouldEqual, 1)
+		})
+	})
+}
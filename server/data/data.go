@@ -1,32 +1,122 @@
 package data
 
+import "time"
+
+// MaxResizes caps how many resizes a session keeps. Past it, the oldest ones are dropped
+// (the first one is always kept in ResizeFrom and ResizeTo, though).
+const MaxResizes = 50
+
 // Data is the structure that holds the information about what the user is doing in the page.
 // This will be "built up" over time, until the user presses the submit button.
 type Data struct {
-	WebsiteURL         string
-	SessionID          string
-	ResizeFrom         Dimension
-	ResizeTo           Dimension
-	CopyAndPaste       map[string]bool // map[fieldId]true
-	FormCompletionTime int             // Seconds
+	WebsiteURL           string                `json:"websiteURL"`
+	SessionID            string                `json:"sessionID"`
+	ResizeFrom           Dimension             `json:"resizeFrom"` // First resize, kept for older readers
+	ResizeTo             Dimension             `json:"resizeTo"`
+	Resizes              []Resize              `json:"resizes"`              // Latest MaxResizes resizes, oldest first
+	ResizeCount          int                   `json:"resizeCount"`          // Every resize, including the ones dropped from Resizes
+	OrientationChanged   bool                  `json:"orientationChanged"`   // Whether any resize went from landscape to portrait or vice-versa
+	CopyAndPaste         map[string]CopyPaste  `json:"copyAndPaste"`         // map[fieldId]what was done with the clipboard on it
+	Keystrokes           map[string]Keystrokes `json:"keystrokes"`           // map[fieldId]how it was typed in
+	FormCompletionTime   int                   `json:"formCompletionTime"`   // Seconds, kept for older readers
+	FormCompletionTimeMs int64                 `json:"formCompletionTimeMs"` // From the first keystroke to submitting the form
+	Timing               Timing                `json:"timing"`
+	State                State                 `json:"state"`
+	CreatedAt            time.Time             `json:"createdAt"`
+	UpdatedAt            time.Time             `json:"updatedAt"` // Last time an event was applied, or the session changed state
 }
 
-// Dimension is the structure that holds the user page's dimensions (w x h).
-type Dimension struct {
-	Width  string `json:"width"`
-	Height string `json:"height"`
+// Resize is the page going from one dimension to another, at some point in time.
+type Resize struct {
+	From Dimension `json:"from"`
+	To   Dimension `json:"to"`
+	At   time.Time `json:"at"`
 }
 
 // New receives a website URL and session ID (the only two required params for this)
-// and returns the created data object ref, whilst adding it to the data store.
+// and returns the created data object ref, whilst adding (a copy of) it to the data store.
 // New assumes that the passed URL and session ID have already been validated (using the Valid() functions).
-func New(websiteURL string, sessionID string) *Data {
+// If the datastore can't store it, the session doesn't exist and the error is returned.
+func New(websiteURL string, sessionID string) (*Data, error) {
+	now := time.Now()
 	d := &Data{
 		WebsiteURL:   websiteURL,
 		SessionID:    sessionID,
-		CopyAndPaste: make(map[string]bool),
+		CopyAndPaste: make(map[string]CopyPaste),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err := Ds.Store(d.WebsiteURL, d.SessionID, d)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Copy returns a deep copy of d. Datastores only ever hand out copies, so that nobody can
+// observe (or change) the stored data outside of their lock.
+// Every map or slice field has to be copied here.
+func (d *Data) Copy() *Data {
+	c := *d
+	if d.Resizes != nil {
+		c.Resizes = make([]Resize, len(d.Resizes))
+		copy(c.Resizes, d.Resizes)
+	}
+	c.Timing = d.Timing.Copy()
+	if d.CopyAndPaste != nil {
+		c.CopyAndPaste = make(map[string]CopyPaste, len(d.CopyAndPaste))
+		for k, v := range d.CopyAndPaste {
+			c.CopyAndPaste[k] = v
+		}
+	}
+	if d.Keystrokes != nil {
+		c.Keystrokes = make(map[string]Keystrokes, len(d.Keystrokes))
+		for k, v := range d.Keystrokes {
+			c.Keystrokes[k] = v
+		}
+	}
+	return &c
+}
+
+// AddResize records the page going from one dimension to another, at some point in time.
+// The first resize is also kept as the resize pair (ResizeFrom and ResizeTo); past MaxResizes,
+// the oldest ones are dropped from Resizes.
+func (d *Data) AddResize(from Dimension, to Dimension, at time.Time) {
+	if from.IsZero() || to.IsZero() {
+		return
+	}
+
+	if d.ResizeFrom.IsZero() && d.ResizeTo.IsZero() {
+		// These only make sense if they're replaced together, I think
+		d.ResizeFrom = from
+		d.ResizeTo = to
 	}
 
-	Ds.Store(d.WebsiteURL, d.SessionID, d)
-	return d
+	d.Resizes = append(d.Resizes, Resize{From: from, To: to, At: at})
+	if len(d.Resizes) > MaxResizes {
+		d.Resizes = append(d.Resizes[:0], d.Resizes[1:]...)
+	}
+	d.ResizeCount++
+
+	if from.Orientation() != to.Orientation() {
+		d.OrientationChanged = true
+	}
+}
+
+// Advance moves d to the requested state, or to StateInProgress if nothing in particular
+// was requested (any event means the visitor is doing something). States only move forward,
+// so asking for an earlier one does nothing.
+// Returns true if the state changed.
+func (d *Data) Advance(requested State) bool {
+	next := requested
+	if next == StateCreated {
+		next = StateInProgress
+	}
+
+	if !d.State.canTransitionTo(next) {
+		return false
+	}
+	d.State = next
+	return true
 }
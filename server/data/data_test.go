@@ -1,7 +1,10 @@
 package data
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	. "github.com/smartystreets/goconvey/convey"
 )
@@ -11,7 +14,8 @@ func TestNew(t *testing.T) {
 		websiteURL := "https://website.com"
 		sessionID := "session"
 
-		d := New(websiteURL, sessionID)
+		d, err := New(websiteURL, sessionID)
+		So(err, ShouldBeNil)
 
 		Convey("should return a 'bare' data reference object with the same data", func() {
 			So(d, ShouldNotBeNil)
@@ -19,17 +23,88 @@ func TestNew(t *testing.T) {
 			So(d.SessionID, ShouldEqual, sessionID)
 			So(d.CopyAndPaste, ShouldBeEmpty)
 			So(d.FormCompletionTime, ShouldBeZeroValue)
-			So(d.ResizeFrom.Height, ShouldEqual, "")
-			So(d.ResizeFrom.Width, ShouldEqual, "")
-			So(d.ResizeTo.Height, ShouldEqual, "")
-			So(d.ResizeTo.Width, ShouldEqual, "")
+			So(d.State, ShouldEqual, StateCreated)
+			So(d.ResizeFrom.Height, ShouldEqual, 0)
+			So(d.ResizeFrom.Width, ShouldEqual, 0)
+			So(d.ResizeTo.Height, ShouldEqual, 0)
+			So(d.ResizeTo.Width, ShouldEqual, 0)
 		})
 
 		Convey("should store the object in the datastore", func() {
 			stored, ok, err := Ds.Get(websiteURL, sessionID)
 			So(err, ShouldBeNil)
 			So(ok, ShouldBeTrue)
-			So(stored, ShouldEqual, d)
+			So(stored, ShouldResemble, d)
+		})
+	})
+}
+
+func TestNewFailingStore(t *testing.T) {
+	Convey("Calling data.New() when the datastore can't store it", t, func() {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ds, err := NewDatastoreFile(dir, 0)
+		So(err, ShouldBeNil)
+		So(ds.Close(), ShouldBeNil) // Writing to a closed log fails
+
+		prev := Ds
+		Ds = ds
+		defer func() { Ds = prev }()
+
+		d, err := New("https://website.com", "failedSession")
+
+		Convey("should return the error, and no session", func() {
+			So(err, ShouldNotBeNil)
+			So(d, ShouldBeNil)
+
+			_, ok, err := ds.Get("https://website.com", "failedSession")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+	})
+}
+
+func TestAddResize(t *testing.T) {
+	Convey("Given a session without a resize", t, func() {
+		d := &Data{}
+
+		Convey("a resize should only be added if both dimensions are there", func() {
+			d.AddResize(Dimension{Width: 100, Height: 200}, Dimension{}, time.Now())
+			So(d.ResizeFrom, ShouldResemble, Dimension{})
+			So(d.ResizeTo, ShouldResemble, Dimension{})
+			So(d.ResizeCount, ShouldBeZeroValue)
+			So(d.Resizes, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestAddResizes(t *testing.T) {
+	Convey("Given a session that's been resized more than MaxResizes times", t, func() {
+		d := &Data{CopyAndPaste: make(map[string]CopyPaste)}
+		start := time.Now()
+		for i := 0; i < MaxResizes+10; i++ {
+			d.AddResize(Dimension{Width: 100 + i, Height: 100}, Dimension{Width: 101 + i, Height: 100}, start.Add(time.Duration(i)*time.Second))
+		}
+
+		Convey("it should only keep the latest ones, in order", func() {
+			So(d.ResizeCount, ShouldEqual, MaxResizes+10)
+			So(len(d.Resizes), ShouldEqual, MaxResizes)
+			So(d.Resizes[0].From.Width, ShouldEqual, 110)
+			So(d.Resizes[MaxResizes-1].From.Width, ShouldEqual, 100+MaxResizes+9)
+			So(d.Resizes[MaxResizes-1].At, ShouldResemble, start.Add(time.Duration(MaxResizes+9)*time.Second))
+		})
+
+		Convey("it should still have the first one as the resize pair", func() {
+			So(d.ResizeFrom, ShouldResemble, Dimension{Width: 100, Height: 100})
+			So(d.ResizeTo, ShouldResemble, Dimension{Width: 101, Height: 100})
+		})
+
+		Convey("copying it shouldn't share the resizes", func() {
+			c := d.Copy()
+			c.Resizes[0].From.Width = 1
+			So(d.Resizes[0].From.Width, ShouldEqual, 110)
 		})
 	})
 }
@@ -1,17 +1,21 @@
 package data
 
+import "time"
+
 var Ds Datastorer
 
 func init() {
-	Ds = &DatastoreMap{
-		m: make(map[string]*Data),
-	}
+	Ds = NewDatastoreMap()
 }
 
 // Datastorer is the interface that defines the line between the application
 // context and the datastore (currently, an in-memory Go map)
+// Implementations never hand out references to the data they hold: everything that goes in
+// or comes out is a copy, and changes are made through a Mutation applied under their lock.
 type Datastorer interface {
 	Get(websiteURL string, sessionID string) (*Data, bool, error)
 	Store(websiteURL string, sessionID string, val *Data) error
-	Mutate(websiteURL string, sessionID string, newData *Data) (*Data, error)
+	Mutate(websiteURL string, sessionID string, m Mutation) (*Data, error)
+	Reap(now time.Time, e Expiry) ([]*Data, error)
+	List(q Query) ([]*Data, error)
 }
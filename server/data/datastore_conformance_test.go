@@ -0,0 +1,422 @@
+package data
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// newDatastorer creates an empty datastore for a conformance test, along with a function
+// that cleans up after it.
+type newDatastorer func() (Datastorer, func())
+
+// pasted is a paste of a whole card number into a field.
+var pasted = NewCopyPaste(ClipboardPaste, 16, true)
+
+// pasteInto is what a paste event in field does to a session.
+func pasteInto(field string) Mutation {
+	return func(d *Data) error {
+		d.AddClipboard(field, pasted, time.Now())
+		d.Advance(StateInProgress)
+		return nil
+	}
+}
+
+// complete is what submitting the form does to a session.
+func complete(d *Data) error {
+	d.SetCompletion(10000, Timing{})
+	d.Advance(StateCompleted)
+	return nil
+}
+
+// testDatastorerConformance runs the behaviour every Datastorer must have against the datastore
+// newDs creates. Every new backend should get a test that calls this.
+func testDatastorerConformance(t *testing.T, newDs newDatastorer) {
+	websiteURL := "https://conformancewebsite.com"
+	sessionID := "conformanceSession"
+
+	bare := func() *Data {
+		return &Data{
+			WebsiteURL:   websiteURL,
+			SessionID:    sessionID,
+			CopyAndPaste: make(map[string]CopyPaste),
+		}
+	}
+
+	Convey("Given an empty datastore", t, func() {
+		ds, cleanup := newDs()
+		defer cleanup()
+
+		Convey("Get should find nothing", func() {
+			d, ok, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+			So(d, ShouldBeNil)
+		})
+
+		Convey("Mutate should fail for a key that doesn't exist", func() {
+			d, err := ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldEqual, errValueNotFound)
+			So(d, ShouldBeNil)
+		})
+
+		Convey("Store should make the value obtainable", func() {
+			So(ds.Store(websiteURL, sessionID, bare()), ShouldBeNil)
+
+			d, ok, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(d.WebsiteURL, ShouldEqual, websiteURL)
+			So(d.SessionID, ShouldEqual, sessionID)
+
+			Convey("but only for that website and session", func() {
+				_, ok, err := ds.Get(websiteURL, "anotherSession")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+
+				_, ok, err = ds.Get("https://anotherwebsite.com", sessionID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeFalse)
+			})
+
+			Convey("and storing again should replace it", func() {
+				replacement := bare()
+				replacement.FormCompletionTime = 42
+				So(ds.Store(websiteURL, sessionID, replacement), ShouldBeNil)
+
+				d, _, err := ds.Get(websiteURL, sessionID)
+				So(err, ShouldBeNil)
+				So(d.FormCompletionTime, ShouldEqual, 42)
+			})
+		})
+	})
+
+	Convey("Given a stored session", t, func() {
+		ds, cleanup := newDs()
+		defer cleanup()
+
+		So(ds.Store(websiteURL, sessionID, bare()), ShouldBeNil)
+
+		Convey("Mutate should fail with a nil value", func() {
+			d, err := ds.Mutate(websiteURL, sessionID, nil)
+			So(err, ShouldEqual, errNilValue)
+			So(d, ShouldBeNil)
+		})
+
+		Convey("a failing mutation shouldn't change anything", func() {
+			errMutation := errors.New("mutation failed")
+			d, err := ds.Mutate(websiteURL, sessionID, func(d *Data) error {
+				d.FormCompletionTime = 10
+				return errMutation
+			})
+			So(err, ShouldEqual, errMutation)
+			So(d, ShouldBeNil)
+
+			d, _, err = ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(d.FormCompletionTime, ShouldBeZeroValue)
+		})
+
+		Convey("a mutation can't move the state backwards", func() {
+			_, err := ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldBeNil)
+
+			_, err = ds.Mutate(websiteURL, sessionID, func(d *Data) error {
+				d.State = StateCreated
+				return nil
+			})
+			So(err, ShouldEqual, errInvalidTransition)
+		})
+
+		Convey("changing what Get returns shouldn't change the stored data", func() {
+			d, _, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			d.FormCompletionTime = 10
+			d.CopyAndPaste["cardNumber"] = pasted
+
+			d, _, err = ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(d.FormCompletionTime, ShouldBeZeroValue)
+			So(d.CopyAndPaste, ShouldBeEmpty)
+		})
+
+		Convey("changing what Mutate returns shouldn't change the stored data", func() {
+			d, err := ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldBeNil)
+			d.CopyAndPaste["cvv"] = pasted
+
+			d, _, err = ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(len(d.CopyAndPaste), ShouldEqual, 1)
+			So(d.CopyAndPaste, ShouldContainKey, "cardNumber")
+		})
+
+		Convey("changing the stored value afterwards shouldn't change the stored data", func() {
+			val := bare()
+			So(ds.Store(websiteURL, sessionID, val), ShouldBeNil)
+			val.CopyAndPaste["cardNumber"] = pasted
+
+			d, _, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(d.CopyAndPaste, ShouldBeEmpty)
+		})
+
+		Convey("mutations should build on each other", func() {
+			_, err := ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldBeNil)
+			_, err = ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldBeNil)
+			d, err := ds.Mutate(websiteURL, sessionID, pasteInto("cvv"))
+			So(err, ShouldBeNil)
+			So(len(d.CopyAndPaste), ShouldEqual, 2)
+			So(d.CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 2)
+			So(d.CopyAndPaste["cvv"].Pastes, ShouldEqual, 1)
+		})
+
+		Convey("the mutated data should be what Get returns afterwards", func() {
+			_, err := ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldBeNil)
+
+			d, ok, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(d.CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 1)
+			So(d.State, ShouldEqual, StateInProgress)
+		})
+
+		Convey("a completed session shouldn't be mutable", func() {
+			_, err := ds.Mutate(websiteURL, sessionID, complete)
+			So(err, ShouldBeNil)
+
+			_, err = ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+			So(err, ShouldEqual, ErrSessionFinished)
+		})
+	})
+
+	Convey("Given sessions across websites and states", t, func() {
+		ds, cleanup := newDs()
+		defer cleanup()
+
+		start := time.Now().Add(-time.Hour)
+		for i := 0; i < 6; i++ {
+			d := bare()
+			d.SessionID = strconv.Itoa(i)
+			d.CreatedAt = start.Add(time.Duration(i) * time.Second)
+			d.UpdatedAt = d.CreatedAt
+			if i%2 == 1 {
+				d.WebsiteURL = "https://anotherwebsite.com"
+			}
+			So(ds.Store(d.WebsiteURL, d.SessionID, d), ShouldBeNil)
+		}
+		_, err := ds.Mutate(websiteURL, "2", complete)
+		So(err, ShouldBeNil)
+
+		sessionIDs := func(sessions []*Data) []string {
+			ids := []string{}
+			for _, d := range sessions {
+				ids = append(ids, d.SessionID)
+			}
+			return ids
+		}
+
+		Convey("List with an empty query should return everything, oldest first", func() {
+			sessions, err := ds.List(Query{})
+			So(err, ShouldBeNil)
+			So(sessionIDs(sessions), ShouldResemble, []string{"0", "1", "2", "3", "4", "5"})
+		})
+
+		Convey("List should filter by website, state and update time", func() {
+			sessions, err := ds.List(Query{WebsiteURL: websiteURL})
+			So(err, ShouldBeNil)
+			So(sessionIDs(sessions), ShouldResemble, []string{"0", "2", "4"})
+
+			sessions, err = ds.List(Query{States: []State{StateCompleted}})
+			So(err, ShouldBeNil)
+			So(sessionIDs(sessions), ShouldResemble, []string{"2"})
+
+			sessions, err = ds.List(Query{Since: start.Add(3 * time.Second)})
+			So(err, ShouldBeNil)
+			So(sessionIDs(sessions), ShouldResemble, []string{"2", "3", "4", "5"})
+		})
+
+		Convey("changing what List returns shouldn't change the stored data", func() {
+			sessions, err := ds.List(Query{})
+			So(err, ShouldBeNil)
+			sessions[0].FormCompletionTime = 42
+
+			d, _, err := ds.Get(sessions[0].WebsiteURL, sessions[0].SessionID)
+			So(err, ShouldBeNil)
+			So(d.FormCompletionTime, ShouldBeZeroValue)
+		})
+	})
+
+	Convey("Given sessions of different ages and states", t, func() {
+		ds, cleanup := newDs()
+		defer cleanup()
+
+		now := time.Now()
+		for _, d := range []*Data{
+			{SessionID: "idle", State: StateInProgress, UpdatedAt: now.Add(-2 * time.Minute)},
+			{SessionID: "active", State: StateInProgress, UpdatedAt: now},
+			{SessionID: "completed", State: StateCompleted, UpdatedAt: now.Add(-2 * time.Minute)},
+			{SessionID: "justCompleted", State: StateCompleted, UpdatedAt: now},
+		} {
+			d.WebsiteURL = websiteURL
+			So(ds.Store(websiteURL, d.SessionID, d), ShouldBeNil)
+		}
+		e := Expiry{Idle: time.Minute, Completed: time.Minute}
+
+		var mu sync.Mutex
+		abandoned := []string{}
+		unregister := OnState(StateAbandoned, func(d *Data) {
+			if d.WebsiteURL != websiteURL {
+				return
+			}
+			mu.Lock()
+			abandoned = append(abandoned, d.SessionID)
+			mu.Unlock()
+		})
+		defer unregister()
+
+		sessionIDs := func(sessions []*Data) []string {
+			ids := []string{}
+			for _, d := range sessions {
+				ids = append(ids, d.SessionID)
+			}
+			sort.Strings(ids)
+			return ids
+		}
+		state := func(sessionID string) State {
+			d, ok, err := ds.Get(websiteURL, sessionID)
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			return d.State
+		}
+
+		Convey("Reap should abandon idle sessions and evict old finished ones", func() {
+			evicted, err := ds.Reap(now, e)
+			So(err, ShouldBeNil)
+			So(sessionIDs(evicted), ShouldResemble, []string{"completed"})
+
+			So(state("idle"), ShouldEqual, StateAbandoned)
+			So(state("active"), ShouldEqual, StateInProgress)
+			So(state("justCompleted"), ShouldEqual, StateCompleted)
+			_, ok, err := ds.Get(websiteURL, "completed")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+
+			Convey("and fire the abandoned hook once for every abandoned session", func() {
+				So(abandoned, ShouldResemble, []string{"idle"})
+
+				_, err := ds.Reap(now, e)
+				So(err, ShouldBeNil)
+				So(abandoned, ShouldResemble, []string{"idle"})
+			})
+
+			Convey("and evict the abandoned ones once they've been finished for long enough", func() {
+				evicted, err := ds.Reap(now.Add(2*time.Minute), Expiry{Completed: time.Minute})
+				So(err, ShouldBeNil)
+				So(sessionIDs(evicted), ShouldResemble, []string{"idle", "justCompleted"})
+				So(state("active"), ShouldEqual, StateInProgress)
+			})
+		})
+
+		Convey("Reap shouldn't do anything with a zero expiry", func() {
+			evicted, err := ds.Reap(now.Add(time.Hour), Expiry{})
+			So(err, ShouldBeNil)
+			So(evicted, ShouldBeEmpty)
+			So(state("idle"), ShouldEqual, StateInProgress)
+			So(abandoned, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given many sessions being used concurrently", t, func() {
+		ds, cleanup := newDs()
+		defer cleanup()
+
+		const sessions = 8
+		const fields = 16
+		for i := 0; i < sessions; i++ {
+			d := bare()
+			d.SessionID = strconv.Itoa(i)
+			So(ds.Store(websiteURL, d.SessionID, d), ShouldBeNil)
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, sessions*fields*2)
+		for i := 0; i < sessions; i++ {
+			for f := 0; f < fields; f++ {
+				wg.Add(1)
+				go func(sessionID string, field string) {
+					defer wg.Done()
+
+					// Reading what comes back while others are writing must be safe
+					d, _, err := ds.Get(websiteURL, sessionID)
+					if err != nil {
+						errs <- err
+					}
+					_ = len(d.CopyAndPaste)
+
+					d, err = ds.Mutate(websiteURL, sessionID, pasteInto(field))
+					if err != nil {
+						errs <- err
+						return
+					}
+					_ = len(d.CopyAndPaste)
+				}(strconv.Itoa(i), strconv.Itoa(f))
+			}
+		}
+		wg.Wait()
+		close(errs)
+
+		Convey("nothing should fail and no update should be lost", func() {
+			for err := range errs {
+				So(err, ShouldBeNil)
+			}
+
+			for i := 0; i < sessions; i++ {
+				d, ok, err := ds.Get(websiteURL, strconv.Itoa(i))
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				So(len(d.CopyAndPaste), ShouldEqual, fields)
+			}
+		})
+	})
+}
+
+func TestDatastoreMapConformance(t *testing.T) {
+	testDatastorerConformance(t, func() (Datastorer, func()) {
+		return NewDatastoreMap(), func() {}
+	})
+}
+
+func TestDatastoreShardedConformance(t *testing.T) {
+	testDatastorerConformance(t, func() (Datastorer, func()) {
+		return NewDatastoreSharded(4), func() {}
+	})
+}
+
+func TestDatastoreFileConformance(t *testing.T) {
+	testDatastorerConformance(t, func() (Datastorer, func()) {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ds, err := NewDatastoreFile(dir, 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ds, func() {
+			ds.Close()
+			os.RemoveAll(dir)
+		}
+	})
+}
@@ -0,0 +1,374 @@
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.json"
+
+	walOpPut    = "put"
+	walOpDelete = "delete"
+)
+
+// walEntry is a single line in the write-ahead log. Every entry holds the full record as it was
+// after the operation, so replaying the log is just a matter of applying the entries in order.
+type walEntry struct {
+	Op   string `json:"op"`
+	Key  string `json:"key"`
+	Data *Data  `json:"data,omitempty"`
+}
+
+// DatastoreFile is a file-backed datastore. It keeps every session in memory (like DatastoreMap),
+// but appends each change to a write-ahead log before applying it, and every so often writes a
+// snapshot of the whole store and truncates the log. On startup the snapshot is loaded and the log
+// replayed on top of it, so a restart doesn't lose any sessions.
+// It implements `Datastore` and is thread-safe.
+type DatastoreFile struct {
+	m  map[string]*Data
+	mu sync.Mutex
+
+	dir           string
+	wal           walFile
+	walSize       int64 // Bytes in the log, up to the end of the last entry
+	walErr        error // Set if the log was left in a state we can't append to
+	walEntries    int
+	snapshotEvery int
+}
+
+// walFile is what the write-ahead log is written to. It's an *os.File, except in tests.
+type walFile interface {
+	io.Writer
+	Sync() error
+	Truncate(size int64) error
+	Close() error
+}
+
+// NewDatastoreFile opens (or creates) a file-backed datastore in dir, rebuilding whatever state was
+// there. A snapshot is taken every snapshotEvery log entries.
+func NewDatastoreFile(dir string, snapshotEvery int) (*DatastoreFile, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &DatastoreFile{
+		m:             make(map[string]*Data),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+	}
+
+	err = ds.loadSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	err = ds.replayWAL()
+	if err != nil {
+		return nil, err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := wal.Stat()
+	if err != nil {
+		wal.Close()
+		return nil, err
+	}
+	ds.wal = wal
+	ds.walSize = info.Size()
+	return ds, nil
+}
+
+// Close closes the write-ahead log. The datastore can't be written to after this.
+func (ds *DatastoreFile) Close() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.wal.Close()
+}
+
+// Get looks for an element in the store, returning a copy of it.
+func (ds *DatastoreFile) Get(websiteURL string, sessionID string) (*Data, bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	d, ok := ds.m[getStoreKey(websiteURL, sessionID)]
+	if !ok {
+		return nil, false, nil
+	}
+	return d.Copy(), true, nil
+}
+
+// Store adds/replaces (a copy of) the value on the specified key, logging it first.
+func (ds *DatastoreFile) Store(websiteURL string, sessionID string, val *Data) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if val == nil {
+		return errNilValue
+	}
+
+	key := getStoreKey(websiteURL, sessionID)
+	return ds.log(walEntry{Op: walOpPut, Key: key, Data: val.Copy()})
+}
+
+// List returns copies of every session matching q, from oldest to newest.
+func (ds *DatastoreFile) List(q Query) ([]*Data, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return listMap(ds.m, q), nil
+}
+
+// Mutate works just like `DatastoreMap.Mutate`, except that the resulting record is logged
+// before the in-memory one is replaced. If logging fails, nothing is changed.
+func (ds *DatastoreFile) Mutate(websiteURL string, sessionID string, m Mutation) (*Data, error) {
+	d, transitioned, err := ds.mutate(websiteURL, sessionID, m)
+	if err != nil {
+		return nil, err
+	}
+
+	if transitioned {
+		fireStateHooks(d.State, d.Copy())
+	}
+	return d, nil
+}
+
+func (ds *DatastoreFile) mutate(websiteURL string, sessionID string, m Mutation) (*Data, bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	key := getStoreKey(websiteURL, sessionID)
+	oldData, ok := ds.m[key]
+	if !ok {
+		return nil, false, errValueNotFound
+	}
+
+	newData, transitioned, err := applyMutation(oldData, m, time.Now())
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = ds.log(walEntry{Op: walOpPut, Key: key, Data: newData})
+	if err != nil {
+		return nil, false, err
+	}
+	return newData.Copy(), transitioned, nil
+}
+
+// Reap works just like `DatastoreMap.Reap`, logging every abandoned and evicted session.
+func (ds *DatastoreFile) Reap(now time.Time, e Expiry) ([]*Data, error) {
+	abandoned, evicted, err := ds.reap(now, e)
+
+	for _, d := range abandoned {
+		fireStateHooks(StateAbandoned, d)
+	}
+	return evicted, err
+}
+
+func (ds *DatastoreFile) reap(now time.Time, e Expiry) ([]*Data, []*Data, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	var abandoned, evicted []*Data
+	for k, d := range ds.m {
+		switch e.check(d, now) {
+		case expiryAbandon:
+			next := d.Copy()
+			next.State = StateAbandoned
+			next.UpdatedAt = now
+
+			err := ds.log(walEntry{Op: walOpPut, Key: k, Data: next})
+			if err != nil {
+				return abandoned, evicted, err
+			}
+			abandoned = append(abandoned, next.Copy())
+		case expiryEvict:
+			err := ds.log(walEntry{Op: walOpDelete, Key: k})
+			if err != nil {
+				return abandoned, evicted, err
+			}
+			evicted = append(evicted, d)
+		}
+	}
+	return abandoned, evicted, nil
+}
+
+// log applies an entry to the in-memory store and appends it to the write-ahead log, taking a
+// snapshot if it's time to. The entry is applied first so the snapshot includes it (it's about
+// to truncate the log it's in). If the entry can't be logged, it's undone.
+// Must be called with the lock held.
+func (ds *DatastoreFile) log(e walEntry) error {
+	prev, existed := ds.m[e.Key]
+	applyEntry(ds.m, e)
+
+	err := ds.appendEntry(e)
+	if err != nil {
+		if existed {
+			ds.m[e.Key] = prev
+		} else {
+			delete(ds.m, e.Key)
+		}
+		return err
+	}
+
+	ds.walEntries++
+	if ds.snapshotEvery > 0 && ds.walEntries >= ds.snapshotEvery {
+		// The entry is safe in the log by now, so a failed snapshot doesn't undo it.
+		// The log just keeps growing, and we try again on the next write.
+		err = ds.snapshot()
+		if err != nil {
+			log.Printf("Failed to snapshot datastore in %v: %v", ds.dir, err)
+		}
+	}
+	return nil
+}
+
+// appendEntry writes an entry to the end of the log. If it can't be written (and synced) in
+// full, the log is truncated back to where it was, so the entry is never replayed and the next
+// one isn't appended to half of it. If even that fails, every later write fails too.
+func (ds *DatastoreFile) appendEntry(e walEntry) error {
+	if ds.walErr != nil {
+		return ds.walErr
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	n, err := ds.wal.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	if err == nil {
+		err = ds.wal.Sync()
+	}
+	if err != nil {
+		truncErr := ds.wal.Truncate(ds.walSize)
+		if truncErr != nil {
+			ds.walErr = truncErr
+			log.Printf("Failed to undo a write to the datastore log in %v, no more writes will be accepted: %v", ds.dir, truncErr)
+		}
+		return err
+	}
+
+	ds.walSize += int64(len(b))
+	return nil
+}
+
+func applyEntry(m map[string]*Data, e walEntry) {
+	switch e.Op {
+	case walOpPut:
+		m[e.Key] = e.Data
+	case walOpDelete:
+		delete(m, e.Key)
+	}
+}
+
+// snapshot writes the whole store to disk and truncates the write-ahead log.
+// The snapshot is written to a temporary file first and then renamed, so a crash midway
+// through leaves the previous snapshot (and the log) untouched.
+// Must be called with the lock held.
+func (ds *DatastoreFile) snapshot() error {
+	path := filepath.Join(ds.dir, snapshotFileName)
+	tmpPath := path + ".tmp"
+
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	err = json.NewEncoder(f).Encode(ds.m)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Sync()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		return err
+	}
+
+	err = ds.wal.Truncate(0)
+	if err != nil {
+		return err
+	}
+	ds.walSize = 0
+	ds.walEntries = 0
+	return nil
+}
+
+func (ds *DatastoreFile) loadSnapshot() error {
+	f, err := os.Open(filepath.Join(ds.dir, snapshotFileName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return json.NewDecoder(f).Decode(&ds.m)
+}
+
+// replayWAL applies every entry in the log. An entry that was only half-written (eg: we crashed
+// while writing it) is cut off the end of the file, so the next one doesn't get appended to it.
+func (ds *DatastoreFile) replayWAL() error {
+	path := filepath.Join(ds.dir, walFileName)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var complete int64 // Bytes up to the end of the last complete entry
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Anything without a trailing newline is an entry that didn't make it to disk
+			// completely, so it never happened.
+			if len(line) > 0 {
+				return os.Truncate(path, complete)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e walEntry
+		err = json.Unmarshal(line, &e)
+		if err != nil {
+			return err
+		}
+
+		applyEntry(ds.m, e)
+		ds.walEntries++
+		complete += int64(len(line))
+	}
+}
@@ -0,0 +1,237 @@
+package data
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatastoreFileGet(t *testing.T) {
+	Convey("Given an existing element in the store", t, func() {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ds, err := NewDatastoreFile(dir, 0)
+		So(err, ShouldBeNil)
+		defer ds.Close()
+
+		d := &Data{
+			WebsiteURL: "https://validwebsite.com",
+			SessionID:  "validSessionForValidWebsite",
+		}
+		So(ds.Store(d.WebsiteURL, d.SessionID, d), ShouldBeNil)
+
+		Convey("it should successfully obtain it", func() {
+			obtained, exists, err := ds.Get(d.WebsiteURL, d.SessionID)
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeTrue)
+			So(obtained, ShouldResemble, d)
+		})
+
+		Convey("when trying to obtain another element, it should return nothing", func() {
+			obtained, exists, err := ds.Get("thisdoesntexist", "nah")
+			So(err, ShouldBeNil)
+			So(exists, ShouldBeFalse)
+			So(obtained, ShouldBeNil)
+		})
+	})
+}
+
+func TestDatastoreFileRecovery(t *testing.T) {
+	Convey("Given a store with some sessions in it", t, func() {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ds, err := NewDatastoreFile(dir, 0)
+		So(err, ShouldBeNil)
+
+		websiteURL := "https://validwebsite.com"
+		for _, sessionID := range []string{"session1", "session2", "session3"} {
+			So(ds.Store(websiteURL, sessionID, &Data{
+				WebsiteURL:   websiteURL,
+				SessionID:    sessionID,
+				CopyAndPaste: make(map[string]CopyPaste),
+				UpdatedAt:    time.Now(),
+			}), ShouldBeNil)
+		}
+
+		_, err = ds.Mutate(websiteURL, "session1", pasteInto("cardNumber"))
+		So(err, ShouldBeNil)
+		_, err = ds.Mutate(websiteURL, "session2", complete)
+		So(err, ShouldBeNil)
+		_, err = ds.Reap(time.Now().Add(time.Hour), Expiry{Completed: time.Minute})
+		So(err, ShouldBeNil)
+
+		assertRecovered := func(ds *DatastoreFile) {
+			d, ok, err := ds.Get(websiteURL, "session1")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+			So(d.CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 1)
+			So(d.State, ShouldEqual, StateInProgress)
+
+			_, ok, err = ds.Get(websiteURL, "session2")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+
+			_, ok, err = ds.Get(websiteURL, "session3")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeTrue)
+		}
+
+		Convey("reopening it should rebuild the same state from the log", func() {
+			So(ds.Close(), ShouldBeNil)
+
+			reopened, err := NewDatastoreFile(dir, 0)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			assertRecovered(reopened)
+		})
+
+		Convey("reopening it after a snapshot should rebuild the same state", func() {
+			ds.mu.Lock()
+			So(ds.snapshot(), ShouldBeNil)
+			ds.mu.Unlock()
+			So(ds.Close(), ShouldBeNil)
+
+			info, err := os.Stat(filepath.Join(dir, walFileName))
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, 0)
+
+			reopened, err := NewDatastoreFile(dir, 0)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			assertRecovered(reopened)
+		})
+
+		Convey("a half-written entry at the end of the log should be ignored", func() {
+			So(ds.Close(), ShouldBeNil)
+
+			f, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_WRONLY|os.O_APPEND, 0644)
+			So(err, ShouldBeNil)
+			_, err = f.WriteString(`{"op":"delete","key":"https://validwebs`)
+			So(err, ShouldBeNil)
+			So(f.Close(), ShouldBeNil)
+
+			reopened, err := NewDatastoreFile(dir, 0)
+			So(err, ShouldBeNil)
+			assertRecovered(reopened)
+
+			Convey("and writing after it should still leave a log we can open", func() {
+				So(reopened.Store(websiteURL, "session4", &Data{WebsiteURL: websiteURL, SessionID: "session4"}), ShouldBeNil)
+				So(reopened.Close(), ShouldBeNil)
+
+				reopened, err := NewDatastoreFile(dir, 0)
+				So(err, ShouldBeNil)
+				defer reopened.Close()
+
+				assertRecovered(reopened)
+				_, ok, err := reopened.Get(websiteURL, "session4")
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestDatastoreFileSnapshotEvery(t *testing.T) {
+	Convey("Given a store that snapshots every 2 entries", t, func() {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ds, err := NewDatastoreFile(dir, 2)
+		So(err, ShouldBeNil)
+		defer ds.Close()
+
+		Convey("writing twice should produce a snapshot and an empty log", func() {
+			So(ds.Store("https://validwebsite.com", "session1", &Data{}), ShouldBeNil)
+			So(ds.Store("https://validwebsite.com", "session2", &Data{}), ShouldBeNil)
+
+			_, err := os.Stat(filepath.Join(dir, snapshotFileName))
+			So(err, ShouldBeNil)
+
+			info, err := os.Stat(filepath.Join(dir, walFileName))
+			So(err, ShouldBeNil)
+			So(info.Size(), ShouldEqual, 0)
+		})
+
+		Convey("the write that triggered the snapshot should survive a reopen", func() {
+			So(ds.Store("https://validwebsite.com", "session1", &Data{}), ShouldBeNil)
+			So(ds.Store("https://validwebsite.com", "session2", &Data{}), ShouldBeNil)
+			So(ds.Store("https://validwebsite.com", "session3", &Data{}), ShouldBeNil)
+			So(ds.Close(), ShouldBeNil)
+
+			reopened, err := NewDatastoreFile(dir, 2)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			for _, sessionID := range []string{"session1", "session2", "session3"} {
+				_, ok, err := reopened.Get("https://validwebsite.com", sessionID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+			}
+		})
+	})
+}
+
+// failingWAL writes only half of what it's given, and then fails.
+type failingWAL struct {
+	*os.File
+	fail bool
+}
+
+func (f *failingWAL) Write(b []byte) (int, error) {
+	if !f.fail {
+		return f.File.Write(b)
+	}
+	n, _ := f.File.Write(b[:len(b)/2])
+	return n, errors.New("disk full")
+}
+
+func TestDatastoreFileFailedWrite(t *testing.T) {
+	Convey("Given a store whose log fails halfway through a write", t, func() {
+		dir, err := ioutil.TempDir("", "datastore-file")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		ds, err := NewDatastoreFile(dir, 0)
+		So(err, ShouldBeNil)
+		wal := &failingWAL{File: ds.wal.(*os.File)}
+		ds.wal = wal
+
+		So(ds.Store("https://validwebsite.com", "session1", &Data{}), ShouldBeNil)
+		wal.fail = true
+		So(ds.Store("https://validwebsite.com", "session2", &Data{}), ShouldNotBeNil)
+
+		Convey("the failed write shouldn't be in the store", func() {
+			_, ok, err := ds.Get("https://validwebsite.com", "session2")
+			So(err, ShouldBeNil)
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("later writes should still leave a log we can open, without the failed one", func() {
+			wal.fail = false
+			So(ds.Store("https://validwebsite.com", "session3", &Data{}), ShouldBeNil)
+			So(ds.Close(), ShouldBeNil)
+
+			reopened, err := NewDatastoreFile(dir, 0)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			for sessionID, exists := range map[string]bool{"session1": true, "session2": false, "session3": true} {
+				_, ok, err := reopened.Get("https://validwebsite.com", sessionID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldEqual, exists)
+			}
+		})
+	})
+}
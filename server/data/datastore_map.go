@@ -3,11 +3,15 @@ package data
 import (
 	"errors"
 	"sync"
+	"time"
 )
 
 var (
 	errValueNotFound = errors.New("Couldn't find value for key")
 	errNilValue      = errors.New("Nil value has been passed")
+
+	// ErrSessionFinished is returned when trying to mutate a session that has already completed or been abandoned.
+	ErrSessionFinished = errors.New("Session has already finished")
 )
 
 // DatastoreMap is ... the datastore for this program (in memory).
@@ -17,70 +21,114 @@ type DatastoreMap struct {
 	mu sync.Mutex
 }
 
-// Get looks for an element in the map.
+// NewDatastoreMap returns an empty in-memory datastore.
+func NewDatastoreMap() *DatastoreMap {
+	return &DatastoreMap{
+		m: make(map[string]*Data),
+	}
+}
+
+// Get looks for an element in the map, returning a copy of it.
 func (ds *DatastoreMap) Get(websiteURL string, sessionID string) (*Data, bool, error) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
 	d, ok := ds.m[getStoreKey(websiteURL, sessionID)]
-	return d, ok, nil
+	if !ok {
+		return nil, false, nil
+	}
+	return d.Copy(), true, nil
 }
 
-// Store adds/replaces the value on the specified key to the map.
+// Store adds/replaces (a copy of) the value on the specified key to the map.
 func (ds *DatastoreMap) Store(websiteURL string, sessionID string, val *Data) error {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	ds.m[getStoreKey(websiteURL, sessionID)] = val
+	if val == nil {
+		return errNilValue
+	}
+
+	ds.m[getStoreKey(websiteURL, sessionID)] = val.Copy()
 	return nil
 }
 
-// Mutate retrieves the old data and replaces it with a new piece of data if the old data doesn't
-// contain a particular parameter (so, sort of a diff)
-// Calling Mutate on a url/session ID combo that doesn't exist will end up in an error.
-// At the end, it'll return the "diff-ed" object.
-func (ds *DatastoreMap) Mutate(websiteURL string, sessionID string, newData *Data) (*Data, error) {
+// List returns copies of every session matching q, from oldest to newest.
+func (ds *DatastoreMap) List(q Query) ([]*Data, error) {
 	ds.mu.Lock()
 	defer ds.mu.Unlock()
 
-	if newData == nil {
-		return nil, errNilValue
+	return listMap(ds.m, q), nil
+}
+
+// Mutate applies m to the data on the specified key (see Mutation) and returns a copy of the result.
+// Calling Mutate on a url/session ID combo that doesn't exist will end up in an error.
+// If the session moved forward in its lifecycle (see State), the hooks for the new state
+// are fired once the lock has been released.
+func (ds *DatastoreMap) Mutate(websiteURL string, sessionID string, m Mutation) (*Data, error) {
+	d, transitioned, err := ds.mutate(websiteURL, sessionID, m)
+	if err != nil {
+		return nil, err
 	}
 
-	oldData, ok := ds.m[getStoreKey(websiteURL, sessionID)]
-	if !ok {
-		return nil, errValueNotFound
+	if transitioned {
+		fireStateHooks(d.State, d.Copy())
 	}
+	return d, nil
+}
 
-	// Since the Go structs don't use pointers, we have to check zero values for everything... *sadface*
-	oldDataHasResizeFrom := oldData.ResizeFrom.Height != "" && oldData.ResizeFrom.Width != ""
-	newDataHasResizeFrom := newData.ResizeFrom.Height != "" && newData.ResizeFrom.Width != ""
+func (ds *DatastoreMap) mutate(websiteURL string, sessionID string, m Mutation) (*Data, bool, error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
-	oldDataHasResizeTo := oldData.ResizeTo.Height != "" && oldData.ResizeTo.Width != ""
-	newDataHasResizeTo := newData.ResizeTo.Height != "" && newData.ResizeTo.Width != ""
+	key := getStoreKey(websiteURL, sessionID)
+	oldData, ok := ds.m[key]
+	if !ok {
+		return nil, false, errValueNotFound
+	}
 
-	if (!oldDataHasResizeFrom && newDataHasResizeFrom) && (!oldDataHasResizeTo && newDataHasResizeTo) {
-		// These only make sense if they're replaced together, I think
-		oldData.ResizeFrom = newData.ResizeFrom
-		oldData.ResizeTo = newData.ResizeTo
+	newData, transitioned, err := applyMutation(oldData, m, time.Now())
+	if err != nil {
+		return nil, false, err
 	}
 
-	if oldData.FormCompletionTime == 0 && newData.FormCompletionTime > 0 {
-		oldData.FormCompletionTime = newData.FormCompletionTime
+	ds.m[key] = newData
+	return newData.Copy(), transitioned, nil
+}
+
+// Reap goes through every session in the map and expires the ones that have been idle for too long
+// (see Expiry). Sessions that are marked as abandoned have their hooks fired once the lock has been released.
+// It returns the sessions that have been evicted from the map.
+func (ds *DatastoreMap) Reap(now time.Time, e Expiry) ([]*Data, error) {
+	abandoned, evicted := ds.reap(now, e)
+
+	for _, d := range abandoned {
+		fireStateHooks(StateAbandoned, d)
 	}
+	return evicted, nil
+}
+
+func (ds *DatastoreMap) reap(now time.Time, e Expiry) ([]*Data, []*Data) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
 
-	// Add & Replace data from new copy and paste map to the old one.
-	// Replacing regardless of existence in the old map since any already existent value
-	// will only be replaced by itself.
-	// We also don't have to worry about this map growing large (and thus making this loop slower in worst case)
-	// as it (almost) directly correlates to fields that people have to put things in per website!
-	for k, v := range newData.CopyAndPaste {
-		if _, ok := oldData.CopyAndPaste[k]; !ok {
-			oldData.CopyAndPaste[k] = v
+	var abandoned, evicted []*Data
+	for k, d := range ds.m {
+		switch e.check(d, now) {
+		case expiryAbandon:
+			next := d.Copy()
+			next.State = StateAbandoned
+			next.UpdatedAt = now
+
+			ds.m[k] = next
+			abandoned = append(abandoned, next.Copy())
+		case expiryEvict:
+			// Nobody else holds a reference to evicted data, so there's no need to copy it
+			delete(ds.m, k)
+			evicted = append(evicted, d)
 		}
 	}
-
-	return oldData, nil
+	return abandoned, evicted
 }
 
 func getStoreKey(websiteURL string, sessionID string) string {
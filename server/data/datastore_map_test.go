@@ -23,7 +23,7 @@ func TestDatastoreMapGet(t *testing.T) {
 			obtained, exists, err := dm.Get(d.WebsiteURL, d.SessionID)
 			So(err, ShouldBeNil)
 			So(exists, ShouldBeTrue)
-			So(obtained, ShouldEqual, d)
+			So(obtained, ShouldResemble, d)
 		})
 	})
 
@@ -60,7 +60,3 @@ func TestDatastoreMapGet(t *testing.T) {
 		})
 	})
 }
-
-func TestDatastoreMapMutate(t *testing.T) {
-	// TODO
-}
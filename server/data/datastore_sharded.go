@@ -0,0 +1,80 @@
+package data
+
+import (
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/hash"
+)
+
+// DatastoreSharded is an in-memory datastore that spreads its keys across a number of
+// independently locked DatastoreMaps (shards), so that requests for different sessions
+// don't all have to wait on the same lock.
+// Keys are assigned to shards by hashing them with the `hash` package.
+// It implements `Datastore` and is thread-safe.
+type DatastoreSharded struct {
+	shards []*DatastoreMap
+}
+
+// NewDatastoreSharded returns an empty sharded datastore with n shards.
+// n should be at least 1; anything less is treated as 1.
+func NewDatastoreSharded(n int) *DatastoreSharded {
+	if n < 1 {
+		n = 1
+	}
+
+	ds := &DatastoreSharded{
+		shards: make([]*DatastoreMap, n),
+	}
+	for i := range ds.shards {
+		ds.shards[i] = NewDatastoreMap()
+	}
+	return ds
+}
+
+// Get looks for an element in its shard.
+func (ds *DatastoreSharded) Get(websiteURL string, sessionID string) (*Data, bool, error) {
+	return ds.shard(websiteURL, sessionID).Get(websiteURL, sessionID)
+}
+
+// Store adds/replaces the value on the specified key in its shard.
+func (ds *DatastoreSharded) Store(websiteURL string, sessionID string, val *Data) error {
+	return ds.shard(websiteURL, sessionID).Store(websiteURL, sessionID, val)
+}
+
+// Mutate works just like `DatastoreMap.Mutate`, only locking the shard the key belongs to.
+func (ds *DatastoreSharded) Mutate(websiteURL string, sessionID string, m Mutation) (*Data, error) {
+	return ds.shard(websiteURL, sessionID).Mutate(websiteURL, sessionID, m)
+}
+
+// List goes through every shard and returns copies of every session matching q, from oldest to newest.
+func (ds *DatastoreSharded) List(q Query) ([]*Data, error) {
+	var sessions []*Data
+	for _, s := range ds.shards {
+		shardSessions, err := s.List(q)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, shardSessions...)
+	}
+
+	sortSessions(sessions)
+	return sessions, nil
+}
+
+// Reap reaps every shard, one at a time, and returns all the evicted sessions.
+func (ds *DatastoreSharded) Reap(now time.Time, e Expiry) ([]*Data, error) {
+	var evicted []*Data
+	for _, s := range ds.shards {
+		shardEvicted, err := s.Reap(now, e)
+		if err != nil {
+			return evicted, err
+		}
+		evicted = append(evicted, shardEvicted...)
+	}
+	return evicted, nil
+}
+
+func (ds *DatastoreSharded) shard(websiteURL string, sessionID string) *DatastoreMap {
+	h := hash.Sum32(getStoreKey(websiteURL, sessionID))
+	return ds.shards[h%uint32(len(ds.shards))]
+}
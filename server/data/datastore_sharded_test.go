@@ -0,0 +1,101 @@
+package data
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatastoreSharded(t *testing.T) {
+	Convey("Given a sharded store with a few sessions in it", t, func() {
+		ds := NewDatastoreSharded(4)
+		websiteURL := "https://validwebsite.com"
+
+		for i := 0; i < 20; i++ {
+			sessionID := strconv.Itoa(i)
+			So(ds.Store(websiteURL, sessionID, &Data{
+				WebsiteURL:   websiteURL,
+				SessionID:    sessionID,
+				CopyAndPaste: make(map[string]CopyPaste),
+				UpdatedAt:    time.Now(),
+			}), ShouldBeNil)
+		}
+
+		Convey("the sessions should be spread across more than one shard", func() {
+			used := 0
+			for _, s := range ds.shards {
+				if len(s.m) > 0 {
+					used++
+				}
+			}
+			So(used, ShouldBeGreaterThan, 1)
+		})
+
+		Convey("every session should be obtainable and mutable", func() {
+			for i := 0; i < 20; i++ {
+				sessionID := strconv.Itoa(i)
+
+				d, ok, err := ds.Get(websiteURL, sessionID)
+				So(err, ShouldBeNil)
+				So(ok, ShouldBeTrue)
+				So(d.SessionID, ShouldEqual, sessionID)
+
+				d, err = ds.Mutate(websiteURL, sessionID, pasteInto("cardNumber"))
+				So(err, ShouldBeNil)
+				So(d.CopyAndPaste["cardNumber"].Pastes, ShouldEqual, 1)
+			}
+		})
+
+		Convey("reaping should go through every shard", func() {
+			_, err := ds.Reap(time.Now().Add(time.Hour), Expiry{Idle: time.Minute})
+			So(err, ShouldBeNil)
+
+			evicted, err := ds.Reap(time.Now().Add(2*time.Hour), Expiry{Completed: time.Minute})
+			So(err, ShouldBeNil)
+			So(len(evicted), ShouldEqual, 20)
+		})
+	})
+}
+
+// benchmarkDatastoreParallel hammers a datastore with a mix of Gets and Mutates (roughly what
+// validURLAndSession + an event handler do) across many sessions, from many goroutines.
+func benchmarkDatastoreParallel(b *testing.B, ds Datastorer) {
+	const sessions = 1024
+	websiteURL := "https://validwebsite.com"
+
+	for i := 0; i < sessions; i++ {
+		sessionID := strconv.Itoa(i)
+		ds.Store(websiteURL, sessionID, &Data{
+			WebsiteURL:   websiteURL,
+			SessionID:    sessionID,
+			CopyAndPaste: make(map[string]CopyPaste),
+		})
+	}
+
+	var n uint64
+	paste := pasteInto("cardNumber")
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			sessionID := strconv.Itoa(int(atomic.AddUint64(&n, 1) % sessions))
+			ds.Get(websiteURL, sessionID)
+			ds.Mutate(websiteURL, sessionID, paste)
+		}
+	})
+}
+
+func BenchmarkDatastoreMapParallel(b *testing.B) {
+	benchmarkDatastoreParallel(b, NewDatastoreMap())
+}
+
+func BenchmarkDatastoreSharded16Parallel(b *testing.B) {
+	benchmarkDatastoreParallel(b, NewDatastoreSharded(16))
+}
+
+func BenchmarkDatastoreSharded64Parallel(b *testing.B) {
+	benchmarkDatastoreParallel(b, NewDatastoreSharded(64))
+}
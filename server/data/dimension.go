@@ -0,0 +1,126 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+)
+
+// MaxDimension is the largest width or height we believe a browser window can have (in CSS pixels).
+// Even an 8K screen zoomed out to 30% doesn't get there, so anything bigger is made up.
+const MaxDimension = 30000
+
+var errInvalidDimension = errors.New("Dimension must be a number")
+
+// Orientation is whether a page is wider than it is tall, or the other way around.
+type Orientation string
+
+// Orientations
+const (
+	OrientationLandscape Orientation = "landscape"
+	OrientationPortrait  Orientation = "portrait"
+	OrientationSquare    Orientation = "square"
+)
+
+// Dimension is the structure that holds the user page's dimensions (w x h).
+type Dimension struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// IsZero tells whether the dimension hasn't been set.
+func (d Dimension) IsZero() bool {
+	return d.Width == 0 && d.Height == 0
+}
+
+// Valid tells whether both sides are positive and no larger than MaxDimension.
+func (d Dimension) Valid() bool {
+	return d.Width > 0 && d.Width <= MaxDimension && d.Height > 0 && d.Height <= MaxDimension
+}
+
+// AspectRatio returns width / height, or 0 if there's no height.
+func (d Dimension) AspectRatio() float64 {
+	if d.Height == 0 {
+		return 0
+	}
+	return float64(d.Width) / float64(d.Height)
+}
+
+// Orientation returns whether the page is landscape, portrait or square.
+func (d Dimension) Orientation() Orientation {
+	switch {
+	case d.Width > d.Height:
+		return OrientationLandscape
+	case d.Width < d.Height:
+		return OrientationPortrait
+	}
+	return OrientationSquare
+}
+
+// dimensionJSON is how a dimension goes out: with the derived fields, so whoever reads it
+// doesn't have to work them out.
+type dimensionJSON struct {
+	Width       int         `json:"width"`
+	Height      int         `json:"height"`
+	AspectRatio float64     `json:"aspectRatio"`
+	Orientation Orientation `json:"orientation"`
+}
+
+// MarshalJSON adds the aspect ratio and orientation to the dimension.
+func (d Dimension) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return json.Marshal(dimensionJSON{})
+	}
+	return json.Marshal(dimensionJSON{
+		Width:       d.Width,
+		Height:      d.Height,
+		AspectRatio: d.AspectRatio(),
+		Orientation: d.Orientation(),
+	})
+}
+
+// UnmarshalJSON accepts both numbers and the strings older clients send (eg: {"width": "100"}).
+// The derived fields are ignored, they're always worked out from the width and height.
+func (d *Dimension) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Width  flexInt `json:"width"`
+		Height flexInt `json:"height"`
+	}
+	err := json.Unmarshal(b, &v)
+	if err != nil {
+		return err
+	}
+
+	d.Width = int(v.Width)
+	d.Height = int(v.Height)
+	return nil
+}
+
+// flexInt is an int that can also be sent as a string. An empty string is 0.
+type flexInt int
+
+func (i *flexInt) UnmarshalJSON(b []byte) error {
+	var n int
+	err := json.Unmarshal(b, &n)
+	if err == nil {
+		*i = flexInt(n)
+		return nil
+	}
+
+	var s string
+	err = json.Unmarshal(b, &s)
+	if err != nil {
+		return errInvalidDimension
+	}
+	if s == "" {
+		*i = 0
+		return nil
+	}
+
+	n, err = strconv.Atoi(s)
+	if err != nil {
+		return errInvalidDimension
+	}
+	*i = flexInt(n)
+	return nil
+}
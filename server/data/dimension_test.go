@@ -0,0 +1,78 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDimensionJSON(t *testing.T) {
+	Convey("Decoding a dimension", t, func() {
+		Convey("should accept numbers", func() {
+			var d Dimension
+			So(json.Unmarshal([]byte(`{"width":100,"height":200}`), &d), ShouldBeNil)
+			So(d, ShouldResemble, Dimension{Width: 100, Height: 200})
+		})
+
+		Convey("should accept the legacy strings", func() {
+			var d Dimension
+			So(json.Unmarshal([]byte(`{"width":"100","height":"200"}`), &d), ShouldBeNil)
+			So(d, ShouldResemble, Dimension{Width: 100, Height: 200})
+
+			So(json.Unmarshal([]byte(`{"width":"","height":""}`), &d), ShouldBeNil)
+			So(d.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("should reject anything else", func() {
+			var d Dimension
+			So(json.Unmarshal([]byte(`{"width":"wide","height":"200"}`), &d), ShouldNotBeNil)
+			So(json.Unmarshal([]byte(`{"width":true,"height":200}`), &d), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Encoding a dimension should add its derived fields", t, func() {
+		b, err := json.Marshal(Dimension{Width: 200, Height: 100})
+		So(err, ShouldBeNil)
+		So(string(b), ShouldEqual, `{"width":200,"height":100,"aspectRatio":2,"orientation":"landscape"}`)
+
+		Convey("and decoding it should give back the same dimension", func() {
+			var d Dimension
+			So(json.Unmarshal(b, &d), ShouldBeNil)
+			So(d, ShouldResemble, Dimension{Width: 200, Height: 100})
+		})
+	})
+}
+
+func TestDimensionValid(t *testing.T) {
+	Convey("A dimension should only be valid within range", t, func() {
+		So(Dimension{Width: 1, Height: MaxDimension}.Valid(), ShouldBeTrue)
+		So(Dimension{Width: 0, Height: 100}.Valid(), ShouldBeFalse)
+		So(Dimension{Width: -1, Height: 100}.Valid(), ShouldBeFalse)
+		So(Dimension{Width: 100, Height: MaxDimension + 1}.Valid(), ShouldBeFalse)
+	})
+
+	Convey("A dimension should know its orientation", t, func() {
+		So(Dimension{Width: 200, Height: 100}.Orientation(), ShouldEqual, OrientationLandscape)
+		So(Dimension{Width: 100, Height: 200}.Orientation(), ShouldEqual, OrientationPortrait)
+		So(Dimension{Width: 100, Height: 100}.Orientation(), ShouldEqual, OrientationSquare)
+		So(Dimension{}.AspectRatio(), ShouldEqual, 0)
+	})
+}
+
+func TestAddResizeOrientationChange(t *testing.T) {
+	Convey("Given a session without a resize", t, func() {
+		d := &Data{CopyAndPaste: make(map[string]CopyPaste)}
+
+		Convey("a resize from landscape to portrait should be flagged as an orientation change", func() {
+			d.AddResize(Dimension{Width: 200, Height: 100}, Dimension{Width: 100, Height: 200}, time.Now())
+			So(d.OrientationChanged, ShouldBeTrue)
+		})
+
+		Convey("a resize that keeps the orientation shouldn't", func() {
+			d.AddResize(Dimension{Width: 200, Height: 100}, Dimension{Width: 300, Height: 100}, time.Now())
+			So(d.OrientationChanged, ShouldBeFalse)
+		})
+	})
+}
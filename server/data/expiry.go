@@ -0,0 +1,38 @@
+package data
+
+import "time"
+
+// Expiry holds how long sessions are kept around for.
+// Sessions that haven't finished and haven't seen an event for longer than Idle are marked as abandoned.
+// Finished sessions (completed or abandoned) are evicted from the datastore once they've been
+// sitting there for longer than Completed.
+// A zero value for either of these disables that particular expiry.
+type Expiry struct {
+	Idle      time.Duration
+	Completed time.Duration
+}
+
+type expiryAction int
+
+const (
+	expiryNone expiryAction = iota
+	expiryAbandon
+	expiryEvict
+)
+
+// check says what should happen to d at the given point in time.
+func (e Expiry) check(d *Data, now time.Time) expiryAction {
+	age := now.Sub(d.UpdatedAt)
+
+	if d.State.Finished() {
+		if e.Completed > 0 && age > e.Completed {
+			return expiryEvict
+		}
+		return expiryNone
+	}
+
+	if e.Idle > 0 && age > e.Idle {
+		return expiryAbandon
+	}
+	return expiryNone
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDatastoreMapReap(t *testing.T) {
+	Convey("Given a map with sessions in different states", t, func() {
+		dm := &DatastoreMap{
+			m: make(map[string]*Data),
+		}
+		now := time.Now()
+		e := Expiry{
+			Idle:      time.Minute,
+			Completed: time.Minute,
+		}
+
+		idle := &Data{WebsiteURL: "https://reapwebsite.com", SessionID: "idle", UpdatedAt: now.Add(-2 * time.Minute)}
+		active := &Data{WebsiteURL: "https://reapwebsite.com", SessionID: "active", UpdatedAt: now}
+		completed := &Data{WebsiteURL: "https://reapwebsite.com", SessionID: "completed", State: StateCompleted, UpdatedAt: now.Add(-2 * time.Minute)}
+		for _, d := range []*Data{idle, active, completed} {
+			dm.m[getStoreKey(d.WebsiteURL, d.SessionID)] = d
+		}
+
+		abandoned := make(map[string]bool)
+		unregister := OnState(StateAbandoned, func(d *Data) {
+			abandoned[d.SessionID] = true
+		})
+		defer unregister()
+
+		Convey("reaping should abandon idle sessions and evict old finished ones", func() {
+			evicted, err := dm.Reap(now, e)
+			So(err, ShouldBeNil)
+			So(len(evicted), ShouldEqual, 1)
+			So(evicted[0], ShouldEqual, completed)
+
+			d, _, _ := dm.Get(idle.WebsiteURL, idle.SessionID)
+			So(d.State, ShouldEqual, StateAbandoned)
+			So(abandoned["idle"], ShouldBeTrue)
+			d, _, _ = dm.Get(active.WebsiteURL, active.SessionID)
+			So(d.State, ShouldEqual, StateCreated)
+			So(abandoned["active"], ShouldBeFalse)
+
+			_, ok, _ := dm.Get(completed.WebsiteURL, completed.SessionID)
+			So(ok, ShouldBeFalse)
+
+			Convey("and the abandoned session should be evicted once it's been finished for long enough", func() {
+				evicted, err := dm.Reap(now.Add(2*time.Minute), e)
+				So(err, ShouldBeNil)
+				So(len(evicted), ShouldEqual, 1)
+				So(evicted[0].SessionID, ShouldEqual, idle.SessionID)
+				So(evicted[0].State, ShouldEqual, StateAbandoned)
+			})
+		})
+
+		Convey("a zero expiry shouldn't reap anything", func() {
+			evicted, err := dm.Reap(now, Expiry{})
+			So(err, ShouldBeNil)
+			So(evicted, ShouldBeEmpty)
+			So(idle.State, ShouldEqual, StateCreated)
+		})
+	})
+}
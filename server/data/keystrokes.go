@@ -0,0 +1,163 @@
+package data
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// BurstGapMs is the longest pause (in milliseconds) between two keystrokes of the same burst.
+// Anything longer and the visitor stopped typing for a bit, so a new burst starts.
+const BurstGapMs = 1000
+
+// Keystroke is a key being pressed in a field. We never get (or keep) which key it was,
+// only when it went down and up and whether it was a backspace.
+// Times are in milliseconds, in the client's clock. Only the differences between them matter.
+type Keystroke struct {
+	DownAt    int64 `json:"downAt"`
+	UpAt      int64 `json:"upAt"` // 0 if the key was still down when the keystrokes were sent
+	Backspace bool  `json:"backspace"`
+}
+
+// Keystrokes is how the visitor typed in a field.
+type Keystrokes struct {
+	Count       int   `json:"count"`
+	Backspaces  int   `json:"backspaces"`
+	Bursts      int   `json:"bursts"`
+	InterKeyMs  Stats `json:"interKeyMs"`  // From one key going down to the next one going down
+	DwellMs     Stats `json:"dwellMs"`     // How long each key was held down
+	BurstLength Stats `json:"burstLength"` // Keystrokes per burst
+}
+
+// NewKeystrokes summarises a run of keystrokes in a field, which must be ordered by DownAt.
+// Runs are summarised on their own: the time between the last keystroke of one and the first
+// of the next (eg: the visitor left the field and came back) doesn't count as an interval.
+func NewKeystrokes(keys []Keystroke) Keystrokes {
+	var k Keystrokes
+	burst := 0
+	for i, key := range keys {
+		k.Count++
+		if key.Backspace {
+			k.Backspaces++
+		}
+		if key.UpAt != 0 {
+			k.DwellMs.Add(key.UpAt - key.DownAt)
+		}
+
+		if i > 0 {
+			gap := key.DownAt - keys[i-1].DownAt
+			k.InterKeyMs.Add(gap)
+			if gap > BurstGapMs {
+				k.Bursts++
+				k.BurstLength.Add(int64(burst))
+				burst = 0
+			}
+		}
+		burst++
+	}
+	if burst > 0 {
+		k.Bursts++
+		k.BurstLength.Add(int64(burst))
+	}
+	return k
+}
+
+// AddKeystrokes adds the keystrokes in a field to the session's. They're only summaries, so
+// they don't grow with the typing.
+func (d *Data) AddKeystrokes(inputID string, k Keystrokes) {
+	if d.Keystrokes == nil {
+		d.Keystrokes = make(map[string]Keystrokes)
+	}
+	d.Keystrokes[inputID] = mergeKeystrokes(d.Keystrokes[inputID], k)
+}
+
+// mergeKeystrokes adds the keystrokes in newK to old.
+func mergeKeystrokes(old Keystrokes, newK Keystrokes) Keystrokes {
+	old.Count += newK.Count
+	old.Backspaces += newK.Backspaces
+	old.Bursts += newK.Bursts
+	old.InterKeyMs = old.InterKeyMs.Merge(newK.InterKeyMs)
+	old.DwellMs = old.DwellMs.Merge(newK.DwellMs)
+	old.BurstLength = old.BurstLength.Merge(newK.BurstLength)
+	return old
+}
+
+// Stats are summary statistics of a series of values. Only what's needed to merge them is kept;
+// the mean and standard deviation are worked out from it.
+type Stats struct {
+	N          int     `json:"n"`
+	Min        int64   `json:"min"`
+	Max        int64   `json:"max"`
+	Sum        int64   `json:"sum"`
+	SumSquares float64 `json:"sumSquares"`
+}
+
+// Add adds v to the series.
+func (s *Stats) Add(v int64) {
+	if s.N == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.N == 0 || v > s.Max {
+		s.Max = v
+	}
+	s.N++
+	s.Sum += v
+	s.SumSquares += float64(v) * float64(v)
+}
+
+// Merge returns the stats of both series together.
+func (s Stats) Merge(o Stats) Stats {
+	if o.N == 0 {
+		return s
+	}
+	if s.N == 0 {
+		return o
+	}
+	if o.Min < s.Min {
+		s.Min = o.Min
+	}
+	if o.Max > s.Max {
+		s.Max = o.Max
+	}
+	s.N += o.N
+	s.Sum += o.Sum
+	s.SumSquares += o.SumSquares
+	return s
+}
+
+// Mean returns the average of the series, or 0 if it's empty.
+func (s Stats) Mean() float64 {
+	if s.N == 0 {
+		return 0
+	}
+	return float64(s.Sum) / float64(s.N)
+}
+
+// StdDev returns the (population) standard deviation of the series, or 0 if it's empty.
+// Humans are all over the place, scripts tend to be suspiciously regular.
+func (s Stats) StdDev() float64 {
+	if s.N == 0 {
+		return 0
+	}
+	mean := s.Mean()
+	variance := s.SumSquares/float64(s.N) - mean*mean
+	if variance < 0 {
+		// Rounding errors on a series that's (nearly) constant
+		return 0
+	}
+	return math.Sqrt(variance)
+}
+
+// MarshalJSON adds the mean and standard deviation to the stats. They're ignored when
+// unmarshalling, as they're always worked out from the rest.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	type stats Stats // Without the methods, so we don't end up back here
+	return json.Marshal(struct {
+		stats
+		Mean   float64 `json:"mean"`
+		StdDev float64 `json:"stdDev"`
+	}{
+		stats:  stats(s),
+		Mean:   s.Mean(),
+		StdDev: s.StdDev(),
+	})
+}
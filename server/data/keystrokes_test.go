@@ -0,0 +1,80 @@
+package data
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewKeystrokes(t *testing.T) {
+	Convey("Given two bursts of typing in a field", t, func() {
+		k := NewKeystrokes([]Keystroke{
+			{DownAt: 1000, UpAt: 1080},
+			{DownAt: 1200, UpAt: 1260},
+			{DownAt: 1300, UpAt: 1400, Backspace: true},
+			{DownAt: 3000, UpAt: 3100},
+			{DownAt: 3100},
+		})
+
+		Convey("it should count the keystrokes, backspaces and bursts", func() {
+			So(k.Count, ShouldEqual, 5)
+			So(k.Backspaces, ShouldEqual, 1)
+			So(k.Bursts, ShouldEqual, 2)
+			So(k.BurstLength.Min, ShouldEqual, 2)
+			So(k.BurstLength.Max, ShouldEqual, 3)
+		})
+
+		Convey("it should summarise the intervals between keys", func() {
+			So(k.InterKeyMs.N, ShouldEqual, 4)
+			So(k.InterKeyMs.Min, ShouldEqual, 100)
+			So(k.InterKeyMs.Max, ShouldEqual, 1700)
+			So(k.InterKeyMs.Mean(), ShouldEqual, 525)
+		})
+
+		Convey("it should only time the keys that were let go of", func() {
+			So(k.DwellMs.N, ShouldEqual, 4)
+			So(k.DwellMs.Min, ShouldEqual, 60)
+			So(k.DwellMs.Max, ShouldEqual, 100)
+		})
+
+		Convey("merging another run should add it up, without an interval between them", func() {
+			m := mergeKeystrokes(k, NewKeystrokes([]Keystroke{{DownAt: 9000, UpAt: 9050}}))
+			So(m.Count, ShouldEqual, 6)
+			So(m.Bursts, ShouldEqual, 3)
+			So(m.InterKeyMs.N, ShouldEqual, 4)
+			So(m.DwellMs.N, ShouldEqual, 5)
+			So(m.DwellMs.Min, ShouldEqual, 50)
+		})
+	})
+}
+
+func TestStats(t *testing.T) {
+	Convey("Given some stats", t, func() {
+		var s Stats
+		for _, v := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+			s.Add(v)
+		}
+
+		Convey("it should work out the mean and standard deviation", func() {
+			So(s.Mean(), ShouldEqual, 5)
+			So(s.StdDev(), ShouldEqual, 2)
+		})
+
+		Convey("merging them with empty ones should leave them as they are", func() {
+			So(s.Merge(Stats{}), ShouldResemble, s)
+			So(Stats{}.Merge(s), ShouldResemble, s)
+		})
+
+		Convey("they should survive a round trip through JSON, with the derived fields", func() {
+			b, err := json.Marshal(s)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldContainSubstring, `"mean":5`)
+			So(string(b), ShouldContainSubstring, `"stdDev":2`)
+
+			var decoded Stats
+			So(json.Unmarshal(b, &decoded), ShouldBeNil)
+			So(decoded, ShouldResemble, s)
+		})
+	})
+}
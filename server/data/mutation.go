@@ -0,0 +1,39 @@
+package data
+
+import (
+	"errors"
+	"time"
+)
+
+var errInvalidTransition = errors.New("Mutation made an invalid state transition")
+
+// Mutation changes a session's data. Datastores apply it under their lock, to a copy of the stored
+// data, and only keep the result if the mutation didn't return an error. This way, callers never
+// get to touch the stored data directly.
+type Mutation func(d *Data) error
+
+// applyMutation runs m on a copy of d and returns the result, along with whether the state changed.
+// It's shared by every Datastorer so they all enforce the same rules: finished sessions can't be
+// mutated, states only move forward and every change bumps the last update time.
+func applyMutation(d *Data, m Mutation, now time.Time) (*Data, bool, error) {
+	if m == nil {
+		return nil, false, errNilValue
+	}
+	if d.State.Finished() {
+		return nil, false, ErrSessionFinished
+	}
+
+	next := d.Copy()
+	err := m(next)
+	if err != nil {
+		return nil, false, err
+	}
+
+	transitioned := next.State != d.State
+	if transitioned && !d.State.canTransitionTo(next.State) {
+		return nil, false, errInvalidTransition
+	}
+
+	next.UpdatedAt = now
+	return next, transitioned, nil
+}
@@ -0,0 +1,54 @@
+package data
+
+import (
+	"sort"
+	"time"
+)
+
+// Query selects which sessions `List` returns. Zero values match everything.
+type Query struct {
+	WebsiteURL string
+	States     []State
+	// Since only matches sessions that have been updated at or after it.
+	Since time.Time
+}
+
+func (q Query) matches(d *Data) bool {
+	if q.WebsiteURL != "" && d.WebsiteURL != q.WebsiteURL {
+		return false
+	}
+	if !q.Since.IsZero() && d.UpdatedAt.Before(q.Since) {
+		return false
+	}
+	if len(q.States) == 0 {
+		return true
+	}
+	for _, s := range q.States {
+		if d.State == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sortSessions orders sessions from oldest to newest, so lists are stable enough to paginate.
+func sortSessions(sessions []*Data) {
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].CreatedAt.Equal(sessions[j].CreatedAt) {
+			return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+		}
+		return getStoreKey(sessions[i].WebsiteURL, sessions[i].SessionID) < getStoreKey(sessions[j].WebsiteURL, sessions[j].SessionID)
+	})
+}
+
+// listMap returns copies of the sessions in m that match q, sorted.
+func listMap(m map[string]*Data, q Query) []*Data {
+	var sessions []*Data
+	for _, d := range m {
+		if q.matches(d) {
+			sessions = append(sessions, d.Copy())
+		}
+	}
+	sortSessions(sessions)
+	return sessions
+}
@@ -0,0 +1,113 @@
+package data
+
+import (
+	"errors"
+	"sync"
+)
+
+var errUnknownState = errors.New("Unknown session state")
+
+// State is where a session is in its lifecycle.
+// Sessions start as StateCreated, move to StateInProgress on their first event and end up
+// either StateCompleted (the form was submitted) or StateAbandoned (the visitor went away).
+type State int
+
+const (
+	StateCreated State = iota
+	StateInProgress
+	StateCompleted
+	StateAbandoned
+)
+
+func (s State) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateInProgress:
+		return "in-progress"
+	case StateCompleted:
+		return "completed"
+	case StateAbandoned:
+		return "abandoned"
+	}
+	return "unknown"
+}
+
+// MarshalText encodes the state as its name, so it's readable in JSON.
+func (s State) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a state from its name.
+func (s *State) UnmarshalText(b []byte) error {
+	for candidate := StateCreated; candidate <= StateAbandoned; candidate++ {
+		if candidate.String() == string(b) {
+			*s = candidate
+			return nil
+		}
+	}
+	return errUnknownState
+}
+
+// Finished says if the session has reached a terminal state. Finished sessions can't be mutated.
+func (s State) Finished() bool {
+	return s == StateCompleted || s == StateAbandoned
+}
+
+// canTransitionTo says if a session can go from s to next.
+// States only ever move forward and nothing leaves a terminal state.
+func (s State) canTransitionTo(next State) bool {
+	return !s.Finished() && next > s
+}
+
+// StateHook is called whenever a session transitions into the state it has been registered for.
+// The datastore guarantees it's called exactly once per session and state, outside of any lock,
+// so it's safe to call the datastore from it. It gets its own copy of the data.
+type StateHook func(d *Data)
+
+// registeredHook is a hook, along with what it was registered as so it can be unregistered.
+type registeredHook struct {
+	id uint64
+	fn StateHook
+}
+
+var (
+	hooks      = make(map[State][]registeredHook)
+	nextHookID uint64
+	hooksMu    sync.RWMutex
+)
+
+// OnState registers a hook for when a session enters state s. It returns a function that
+// unregisters it again, which is safe to call more than once.
+func OnState(s State, fn StateHook) func() {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+
+	nextHookID++
+	id := nextHookID
+	hooks[s] = append(hooks[s], registeredHook{id: id, fn: fn})
+
+	return func() {
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+
+		// Copied rather than changed in place, as the hooks being fired may still be using the old slice
+		var kept []registeredHook
+		for _, h := range hooks[s] {
+			if h.id != id {
+				kept = append(kept, h)
+			}
+		}
+		hooks[s] = kept
+	}
+}
+
+func fireStateHooks(s State, d *Data) {
+	hooksMu.RLock()
+	hs := hooks[s]
+	hooksMu.RUnlock()
+
+	for _, h := range hs {
+		h.fn(d)
+	}
+}
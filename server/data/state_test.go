@@ -0,0 +1,111 @@
+package data
+
+import (
+	"sync"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStateTransitions(t *testing.T) {
+	Convey("Given a created session", t, func() {
+		d := &Data{}
+
+		Convey("any event should move it to in-progress", func() {
+			So(d.Advance(StateCreated), ShouldBeTrue)
+			So(d.State, ShouldEqual, StateInProgress)
+
+			Convey("and further events shouldn't change it", func() {
+				So(d.Advance(StateCreated), ShouldBeFalse)
+				So(d.State, ShouldEqual, StateInProgress)
+			})
+		})
+
+		Convey("it should be able to go straight to completed", func() {
+			So(d.Advance(StateCompleted), ShouldBeTrue)
+			So(d.State, ShouldEqual, StateCompleted)
+
+			Convey("and never leave it", func() {
+				So(d.Advance(StateAbandoned), ShouldBeFalse)
+				So(d.State, ShouldEqual, StateCompleted)
+			})
+		})
+	})
+}
+
+func TestDatastoreMapMutateState(t *testing.T) {
+	Convey("Given a session in the map and a completion hook", t, func() {
+		dm := &DatastoreMap{
+			m: make(map[string]*Data),
+		}
+		d := &Data{
+			WebsiteURL:   "https://statewebsite.com",
+			SessionID:    "stateSession",
+			CopyAndPaste: make(map[string]CopyPaste),
+		}
+		dm.m[getStoreKey(d.WebsiteURL, d.SessionID)] = d
+
+		var mu sync.Mutex
+		completions := 0
+		unregister := OnState(StateCompleted, func(c *Data) {
+			if c.SessionID != d.SessionID {
+				return
+			}
+			mu.Lock()
+			completions++
+			mu.Unlock()
+		})
+		defer unregister()
+
+		Convey("a regular event should put it in progress", func() {
+			newData, err := dm.Mutate(d.WebsiteURL, d.SessionID, pasteInto("input"))
+			So(err, ShouldBeNil)
+			So(newData.State, ShouldEqual, StateInProgress)
+			So(completions, ShouldEqual, 0)
+		})
+
+		Convey("concurrent completing events should fire the hook exactly once", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < 10; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					dm.Mutate(d.WebsiteURL, d.SessionID, complete)
+				}()
+			}
+			wg.Wait()
+
+			So(completions, ShouldEqual, 1)
+			So(dm.m[getStoreKey(d.WebsiteURL, d.SessionID)].State, ShouldEqual, StateCompleted)
+
+			Convey("and the session shouldn't be mutable anymore", func() {
+				_, err := dm.Mutate(d.WebsiteURL, d.SessionID, pasteInto("input"))
+				So(err, ShouldEqual, ErrSessionFinished)
+			})
+		})
+	})
+}
+
+func TestOnState(t *testing.T) {
+	Convey("Given a hook for abandoned sessions", t, func() {
+		d := &Data{WebsiteURL: "https://hookwebsite.com", SessionID: "hookSession"}
+		calls := 0
+		unregister := OnState(StateAbandoned, func(a *Data) {
+			if a.SessionID == d.SessionID {
+				calls++
+			}
+		})
+		defer unregister()
+
+		Convey("it should be called when a session is abandoned", func() {
+			fireStateHooks(StateAbandoned, d)
+			So(calls, ShouldEqual, 1)
+		})
+
+		Convey("it shouldn't be called anymore once unregistered", func() {
+			unregister()
+			fireStateHooks(StateAbandoned, d)
+			So(calls, ShouldBeZeroValue)
+		})
+	})
+}
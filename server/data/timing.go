@@ -0,0 +1,77 @@
+package data
+
+import "time"
+
+// Timing is when things happened in the page. Every time in it is in server time: the client's
+// timestamps are corrected by ClockSkewMs.
+type Timing struct {
+	FirstKeystrokeAt time.Time `json:"firstKeystrokeAt"`
+	SubmittedAt      time.Time `json:"submittedAt"`
+	ReceivedAt       time.Time `json:"receivedAt"` // When we got the submit
+	// ClockSkewMs is how far ahead of ours the client's clock is, estimated from when it says it
+	// sent the submit and when we got it. That's the real skew minus the network latency, so it's
+	// a lower bound: the client's clock is at least this far ahead (or at most this far behind, if
+	// it's negative), and the corrected times can be up to the latency late.
+	ClockSkewMs int64                  `json:"clockSkewMs"`
+	Fields      map[string]FieldTiming `json:"fields"` // map[fieldId]timing
+}
+
+// FieldTiming is how the visitor went through a field.
+type FieldTiming struct {
+	Focuses   int       `json:"focuses"`
+	FocusedAt time.Time `json:"focusedAt"` // First focus
+	BlurredAt time.Time `json:"blurredAt"` // Last blur
+	FocusedMs int64     `json:"focusedMs"` // Total time spent in the field
+}
+
+// AddFocus adds a visit to the field, from focusedAt to blurredAt. A zero blurredAt means the
+// field never lost focus (eg: the form was submitted with the enter key).
+func (ft *FieldTiming) AddFocus(focusedAt time.Time, blurredAt time.Time) {
+	ft.Focuses++
+	if ft.FocusedAt.IsZero() || focusedAt.Before(ft.FocusedAt) {
+		ft.FocusedAt = focusedAt
+	}
+	if blurredAt.IsZero() {
+		return
+	}
+	if blurredAt.After(ft.BlurredAt) {
+		ft.BlurredAt = blurredAt
+	}
+	ft.FocusedMs += int64(blurredAt.Sub(focusedAt) / time.Millisecond)
+}
+
+// SetCompletion records how long the form took to complete (from the first keystroke to
+// submitting it) and, if there is one, its timing. Only the first completion counts.
+func (d *Data) SetCompletion(ms int64, t Timing) {
+	if d.FormCompletionTimeMs > 0 || ms <= 0 {
+		return
+	}
+	d.FormCompletionTimeMs = ms
+	d.FormCompletionTime = int((ms + 500) / 1000)
+	if !t.IsZero() {
+		d.Timing = t.Copy()
+	}
+}
+
+// IsZero tells whether there's no timing at all.
+func (t Timing) IsZero() bool {
+	return t.ReceivedAt.IsZero()
+}
+
+// Copy returns a deep copy of t.
+func (t Timing) Copy() Timing {
+	if t.Fields != nil {
+		fields := make(map[string]FieldTiming, len(t.Fields))
+		for k, v := range t.Fields {
+			fields[k] = v
+		}
+		t.Fields = fields
+	}
+	return t
+}
+
+// FromClockMs converts a client timestamp (milliseconds since the epoch, in the client's clock)
+// to server time, given the clock skew.
+func FromClockMs(ms int64, skewMs int64) time.Time {
+	return time.Unix(0, (ms-skewMs)*int64(time.Millisecond))
+}
@@ -0,0 +1,86 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestFieldTimingAddFocus(t *testing.T) {
+	Convey("Given a field that's been visited twice", t, func() {
+		start := time.Unix(1700000000, 0)
+		var ft FieldTiming
+		ft.AddFocus(start.Add(5*time.Second), start.Add(6*time.Second))
+		ft.AddFocus(start, start.Add(1500*time.Millisecond))
+
+		Convey("it should count both visits and add up their time", func() {
+			So(ft.Focuses, ShouldEqual, 2)
+			So(ft.FocusedMs, ShouldEqual, 2500)
+		})
+
+		Convey("it should keep the first focus and the last blur", func() {
+			So(ft.FocusedAt, ShouldResemble, start)
+			So(ft.BlurredAt, ShouldResemble, start.Add(6*time.Second))
+		})
+
+		Convey("a visit that never blurred should only count as a focus", func() {
+			ft.AddFocus(start.Add(10*time.Second), time.Time{})
+			So(ft.Focuses, ShouldEqual, 3)
+			So(ft.FocusedMs, ShouldEqual, 2500)
+			So(ft.BlurredAt, ShouldResemble, start.Add(6*time.Second))
+		})
+	})
+}
+
+func TestFromClockMs(t *testing.T) {
+	Convey("Converting a client timestamp", t, func() {
+		Convey("should take the skew away", func() {
+			So(FromClockMs(10500, 500).Equal(time.Unix(10, 0)), ShouldBeTrue)
+			So(FromClockMs(9500, -500).Equal(time.Unix(10, 0)), ShouldBeTrue)
+		})
+	})
+}
+
+func TestTimingCopy(t *testing.T) {
+	Convey("Copying a timing", t, func() {
+		tm := Timing{
+			ReceivedAt: time.Now(),
+			Fields:     map[string]FieldTiming{"email": {Focuses: 1}},
+		}
+		c := tm.Copy()
+
+		Convey("shouldn't share the fields", func() {
+			c.Fields["email"] = FieldTiming{Focuses: 5}
+			So(tm.Fields["email"].Focuses, ShouldEqual, 1)
+		})
+
+		Convey("should keep it non-zero", func() {
+			So(c.IsZero(), ShouldBeFalse)
+			So(Timing{}.IsZero(), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSetCompletion(t *testing.T) {
+	Convey("Given a session that hasn't been completed", t, func() {
+		d := &Data{}
+
+		Convey("a completion without a time shouldn't count", func() {
+			d.SetCompletion(0, Timing{})
+			So(d.FormCompletionTimeMs, ShouldBeZeroValue)
+		})
+
+		Convey("the first completion should win", func() {
+			first := Timing{ReceivedAt: time.Now()}
+			d.SetCompletion(10400, first)
+			So(d.FormCompletionTimeMs, ShouldEqual, 10400)
+			So(d.FormCompletionTime, ShouldEqual, 10)
+			So(d.Timing.ReceivedAt, ShouldResemble, first.ReceivedAt)
+
+			d.SetCompletion(20000, Timing{ReceivedAt: time.Now().Add(time.Second)})
+			So(d.FormCompletionTimeMs, ShouldEqual, 10400)
+			So(d.Timing.ReceivedAt, ShouldResemble, first.ReceivedAt)
+		})
+	})
+}
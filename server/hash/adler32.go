@@ -0,0 +1,107 @@
+package hash
+
+import (
+	stdhash "hash"
+)
+
+const (
+	// adlerMod is the largest prime smaller than 2^16.
+	adlerMod = 65521
+	// adlerNMax is the most bytes we can add up before a and b have to be reduced,
+	// so that b doesn't overflow a uint32 (see zlib's adler32.c).
+	adlerNMax = 5552
+
+	adlerSize = 4
+)
+
+// Adler32 is an Adler-32 checksum. It implements Go's `hash.Hash32`, and it can also be
+// used as a rolling checksum over a fixed-size window (see Roll).
+// The zero value isn't ready to use; create one with NewAdler32.
+type Adler32 struct {
+	a, b uint32
+	n    uint64 // Bytes in the window (or written so far, if we're not rolling)
+}
+
+var _ stdhash.Hash32 = (*Adler32)(nil)
+
+// NewAdler32 returns a new Adler-32 checksum.
+func NewAdler32() *Adler32 {
+	d := &Adler32{}
+	d.Reset()
+	return d
+}
+
+// Reset resets the checksum to its initial state.
+func (d *Adler32) Reset() {
+	d.a = 1
+	d.b = 0
+	d.n = 0
+}
+
+// Size returns the number of bytes Sum will append.
+func (d *Adler32) Size() int {
+	return adlerSize
+}
+
+// BlockSize returns the checksum's underlying block size.
+func (d *Adler32) BlockSize() int {
+	return adlerSize
+}
+
+// Write adds p to the checksum. It never returns an error.
+func (d *Adler32) Write(p []byte) (int, error) {
+	n := len(p)
+	a, b := d.a, d.b
+
+	// Only reduce every adlerNMax bytes, which is as long as we can go without overflowing.
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > adlerNMax {
+			chunk = chunk[:adlerNMax]
+		}
+		p = p[len(chunk):]
+
+		for _, by := range chunk {
+			a += uint32(by)
+			b += a
+		}
+		a %= adlerMod
+		b %= adlerMod
+	}
+
+	d.a, d.b = a, b
+	d.n += uint64(n)
+	return n, nil
+}
+
+// Sum32 returns the checksum.
+func (d *Adler32) Sum32() uint32 {
+	return d.b<<16 | d.a
+}
+
+// Sum appends the checksum (big-endian) to in and returns the resulting slice.
+func (d *Adler32) Sum(in []byte) []byte {
+	s := d.Sum32()
+	return append(in, byte(s>>24), byte(s>>16), byte(s>>8), byte(s))
+}
+
+// Roll slides the window the checksum covers by one byte: out is the byte leaving the window
+// (its first byte) and in is the one entering it (after its last byte).
+// The window is whatever was written since the last Reset, so the usual way of using this is
+// to Write the first window and then keep Rolling.
+func (d *Adler32) Roll(out byte, in byte) {
+	nMod := uint32(d.n % adlerMod)
+
+	// Adding adlerMod before subtracting keeps everything positive.
+	a := (d.a + adlerMod - uint32(out) + uint32(in)) % adlerMod
+	b := (d.b + adlerMod - (nMod*uint32(out))%adlerMod + a + adlerMod - 1) % adlerMod
+
+	d.a, d.b = a, b
+}
+
+// Checksum returns the Adler-32 checksum of p.
+func Checksum(p []byte) uint32 {
+	d := NewAdler32()
+	d.Write(p)
+	return d.Sum32()
+}
@@ -0,0 +1,112 @@
+package hash
+
+import (
+	"bytes"
+	"hash/adler32"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var adler32Vectors = []struct {
+	in   []byte
+	want uint32
+}{
+	{[]byte(""), 0x00000001},
+	{[]byte("a"), 0x00620062},
+	{[]byte("abc"), 0x024d0127},
+	{[]byte("hello"), 0x062c0215},
+	{[]byte("message digest"), 0x29750586},
+	{[]byte("abcdefghijklmnopqrstuvwxyz"), 0x90860b20},
+	{[]byte("Wikipedia"), 0x11e60398},
+	{bytes.Repeat([]byte("a"), 1000000), 0x15d870f9},
+	{bytes.Repeat([]byte{0xff}, 1<<20), 0x8e88ef11},
+}
+
+func TestAdler32(t *testing.T) {
+	Convey("Given a table of known Adler-32 vectors", t, func() {
+		Convey("Checksum should match every one of them", func() {
+			for _, v := range adler32Vectors {
+				So(Checksum(v.in), ShouldEqual, v.want)
+			}
+		})
+
+		Convey("writing in small pieces should give the same result", func() {
+			for _, v := range adler32Vectors {
+				d := NewAdler32()
+				for i := 0; i < len(v.in); i += 7 {
+					end := i + 7
+					if end > len(v.in) {
+						end = len(v.in)
+					}
+					d.Write(v.in[i:end])
+				}
+				So(d.Sum32(), ShouldEqual, v.want)
+			}
+		})
+
+		Convey("Sum should append the big-endian checksum", func() {
+			d := NewAdler32()
+			d.Write([]byte("Wikipedia"))
+			So(d.Sum([]byte{0xaa}), ShouldResemble, []byte{0xaa, 0x11, 0xe6, 0x03, 0x98})
+			So(d.Size(), ShouldEqual, 4)
+			So(d.BlockSize(), ShouldEqual, 4)
+		})
+
+		Convey("Reset should bring it back to its initial state", func() {
+			d := NewAdler32()
+			d.Write([]byte("Wikipedia"))
+			d.Reset()
+			So(d.Sum32(), ShouldEqual, uint32(1))
+		})
+	})
+
+	Convey("Given a large input", t, func() {
+		in := make([]byte, 3<<20)
+		for i := range in {
+			in[i] = byte(i*31 + i>>8)
+		}
+
+		Convey("it should match the standard library", func() {
+			So(Checksum(in), ShouldEqual, adler32.Checksum(in))
+		})
+	})
+}
+
+func TestAdler32Roll(t *testing.T) {
+	Convey("Given a checksum over a window of some input", t, func() {
+		in := bytes.Repeat([]byte("the quick brown fox jumps over the lazy dog \xff\x00"), 2000)
+		const window = 64
+
+		d := NewAdler32()
+		d.Write(in[:window])
+
+		Convey("rolling it forward should always match checksumming the window from scratch", func() {
+			for i := window; i < len(in); i++ {
+				d.Roll(in[i-window], in[i])
+				if d.Sum32() != Checksum(in[i-window+1:i+1]) {
+					So(d.Sum32(), ShouldEqual, Checksum(in[i-window+1:i+1]))
+				}
+			}
+			So(d.Sum32(), ShouldEqual, Checksum(in[len(in)-window:]))
+		})
+	})
+
+	Convey("Given a window larger than the modulus", t, func() {
+		in := make([]byte, 70000+1000)
+		for i := range in {
+			in[i] = byte(i * 7)
+		}
+		const window = 70000
+
+		d := NewAdler32()
+		d.Write(in[:window])
+
+		Convey("rolling should still match", func() {
+			for i := window; i < len(in); i++ {
+				d.Roll(in[i-window], in[i])
+			}
+			So(d.Sum32(), ShouldEqual, Checksum(in[len(in)-window:]))
+		})
+	})
+}
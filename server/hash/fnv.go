@@ -0,0 +1,28 @@
+package hash
+
+const (
+	fnv32Offset = 2166136261
+	fnv32Prime  = 16777619
+	fnv64Offset = 14695981039346656037
+	fnv64Prime  = 1099511628211
+)
+
+// FNV1a32 returns the 32-bit FNV-1a hash of p.
+func FNV1a32(p []byte) uint32 {
+	h := uint32(fnv32Offset)
+	for _, by := range p {
+		h ^= uint32(by)
+		h *= fnv32Prime
+	}
+	return h
+}
+
+// FNV1a64 returns the 64-bit FNV-1a hash of p.
+func FNV1a64(p []byte) uint64 {
+	h := uint64(fnv64Offset)
+	for _, by := range p {
+		h ^= uint64(by)
+		h *= fnv64Prime
+	}
+	return h
+}
@@ -1,24 +1,18 @@
 package hash
 
-import (
-	"fmt"
-)
-
-// New will return the Adler32 hash of whatever you pass into it.
-// Beware that this doesn't support rolling, so if the input is too big,
-// the uint32 will overflow and the hash will be incorrect.
+// New will return the hash of whatever you pass into it, using the default algorithm
+// (Adler32, unless changed with SetDefault).
 // Returns the base16 representation of the hash as a string.
 func New(s string) string {
-	bytes := []byte(s)
-
-	a := uint32(1)
-	b := uint32(0)
-	mod := uint32(65521)
+	hashersMu.RLock()
+	h := defaultHasher
+	hashersMu.RUnlock()
 
-	for _, by := range bytes {
-		a += uint32(by) % mod
-		b += a % mod
-	}
+	return Hex(h, s)
+}
 
-	return fmt.Sprintf("%x", (b<<16)|a)
+// Sum32 returns the Adler32 hash of s as a number, regardless of the default algorithm.
+// Useful when the hash is used for something other than displaying it (eg: picking a bucket).
+func Sum32(s string) uint32 {
+	return Checksum([]byte(s))
 }
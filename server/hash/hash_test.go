@@ -20,3 +20,12 @@ func TestHashNew(t *testing.T) {
 		})
 	})
 }
+
+func TestHashSum32(t *testing.T) {
+	Convey("Given a valid string", t, func() {
+		s := "hello"
+		Convey("it should return the same hash as New, as a number", func() {
+			So(Sum32(s), ShouldEqual, uint32(0x62c0215))
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var errUnknownHasher = errors.New("Unknown hash algorithm")
+
+// Hasher is a non-cryptographic hash algorithm.
+type Hasher interface {
+	// Sum64 returns the hash of p. Algorithms smaller than 64 bits leave the top bits empty.
+	Sum64(p []byte) uint64
+	// Size is how many bytes the hash has.
+	Size() int
+}
+
+// HasherFunc turns a function into a Hasher of the given size (in bytes).
+type HasherFunc struct {
+	Fn    func(p []byte) uint64
+	Bytes int
+}
+
+// Sum64 calls the function.
+func (h HasherFunc) Sum64(p []byte) uint64 {
+	return h.Fn(p)
+}
+
+// Size returns the size of the hash.
+func (h HasherFunc) Size() int {
+	return h.Bytes
+}
+
+// DefaultHasher is the algorithm New uses unless told otherwise (see SetDefault).
+const DefaultHasher = "adler32"
+
+var (
+	hashers = map[string]Hasher{
+		"adler32":  HasherFunc{Fn: func(p []byte) uint64 { return uint64(Checksum(p)) }, Bytes: 4},
+		"fnv1a32":  HasherFunc{Fn: func(p []byte) uint64 { return uint64(FNV1a32(p)) }, Bytes: 4},
+		"fnv1a64":  HasherFunc{Fn: FNV1a64, Bytes: 8},
+		"murmur3":  HasherFunc{Fn: func(p []byte) uint64 { return uint64(Murmur3(p, 0)) }, Bytes: 4},
+		"xxhash64": HasherFunc{Fn: func(p []byte) uint64 { return XXHash64(p, 0) }, Bytes: 8},
+	}
+	defaultHasher = hashers[DefaultHasher]
+	hashersMu     sync.RWMutex
+)
+
+// Register adds a hash algorithm under the given name, replacing any existing one.
+func Register(name string, h Hasher) {
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	hashers[name] = h
+}
+
+// Get returns the hash algorithm registered under the given name.
+func Get(name string) (Hasher, bool) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	h, ok := hashers[name]
+	return h, ok
+}
+
+// Names returns the names of every registered hash algorithm, sorted.
+func Names() []string {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetDefault changes the algorithm New uses.
+func SetDefault(name string) error {
+	h, ok := Get(name)
+	if !ok {
+		return errUnknownHasher
+	}
+
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+
+	defaultHasher = h
+	return nil
+}
+
+// Hex returns the base16 representation of the hash of s using h.
+func Hex(h Hasher, s string) string {
+	return fmt.Sprintf("%x", h.Sum64([]byte(s)))
+}
+
+// Collisions returns how many of the (distinct) strings in corpus hash to a value that an earlier
+// string already hashed to using h. Useful to compare algorithms on real data.
+func Collisions(h Hasher, corpus []string) int {
+	seen := make(map[uint64]string, len(corpus))
+	collisions := 0
+	for _, s := range corpus {
+		sum := h.Sum64([]byte(s))
+		if prev, ok := seen[sum]; ok {
+			if prev != s {
+				collisions++
+			}
+			continue
+		}
+		seen[sum] = s
+	}
+	return collisions
+}
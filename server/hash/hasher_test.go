@@ -0,0 +1,90 @@
+package hash
+
+import (
+	"hash/fnv"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHasherVectors(t *testing.T) {
+	Convey("Given known inputs", t, func() {
+		inputs := []string{"", "a", "abc", "hello", "https://www.website.com/checkout?step=2"}
+
+		Convey("FNV-1a should match the standard library", func() {
+			for _, s := range inputs {
+				h32 := fnv.New32a()
+				h32.Write([]byte(s))
+				So(FNV1a32([]byte(s)), ShouldEqual, h32.Sum32())
+
+				h64 := fnv.New64a()
+				h64.Write([]byte(s))
+				So(FNV1a64([]byte(s)), ShouldEqual, h64.Sum64())
+			}
+		})
+
+		Convey("MurmurHash3 should match its reference vectors", func() {
+			So(Murmur3([]byte(""), 0), ShouldEqual, uint32(0))
+			So(Murmur3([]byte(""), 1), ShouldEqual, uint32(0x514e28b7))
+			So(Murmur3([]byte("abc"), 0), ShouldEqual, uint32(0xb3dd93fa))
+			So(Murmur3([]byte("hello"), 0), ShouldEqual, uint32(0x248bfa47))
+			So(Murmur3([]byte("aaaa"), 0x9747b28c), ShouldEqual, uint32(0x5a97808a))
+			So(Murmur3([]byte("The quick brown fox jumps over the lazy dog"), 0), ShouldEqual, uint32(0x2e4ff723))
+		})
+
+		Convey("xxHash64 should match its reference vectors", func() {
+			So(XXHash64([]byte(""), 0), ShouldEqual, uint64(0xef46db3751d8e999))
+			So(XXHash64([]byte("a"), 0), ShouldEqual, uint64(0xd24ec4f1a98c6e5b))
+			So(XXHash64([]byte("abc"), 0), ShouldEqual, uint64(0x44bc2cf5ad770999))
+			So(XXHash64([]byte("Nobody inspects the spammish repetition"), 0), ShouldEqual, uint64(0xfbcea83c8a378bf1))
+		})
+	})
+}
+
+func TestHasherRegistry(t *testing.T) {
+	Convey("Given the built-in hash algorithms", t, func() {
+		Convey("every one of them should be obtainable by name", func() {
+			for _, name := range []string{"adler32", "fnv1a32", "fnv1a64", "murmur3", "xxhash64"} {
+				h, ok := Get(name)
+				So(ok, ShouldBeTrue)
+				So(h, ShouldNotBeNil)
+			}
+			So(Names(), ShouldContain, "xxhash64")
+		})
+
+		Convey("changing the default should change what New returns", func() {
+			So(New("hello"), ShouldEqual, "62c0215")
+
+			So(SetDefault("fnv1a32"), ShouldBeNil)
+			defer SetDefault(DefaultHasher)
+			So(New("hello"), ShouldEqual, "4f9f2cab")
+		})
+
+		Convey("an unknown algorithm can't be the default", func() {
+			So(SetDefault("nope"), ShouldEqual, errUnknownHasher)
+		})
+
+		Convey("a registered algorithm should be obtainable", func() {
+			Register("constant", HasherFunc{Fn: func(p []byte) uint64 { return 42 }, Bytes: 1})
+			h, ok := Get("constant")
+			So(ok, ShouldBeTrue)
+			So(h.Sum64([]byte("anything")), ShouldEqual, 42)
+		})
+	})
+}
+
+func TestCollisions(t *testing.T) {
+	Convey("Given a corpus of strings", t, func() {
+		corpus := []string{"a", "b", "c", "a"}
+
+		Convey("a hash that always collides should count every distinct string but the first", func() {
+			h := HasherFunc{Fn: func(p []byte) uint64 { return 0 }, Bytes: 1}
+			So(Collisions(h, corpus), ShouldEqual, 2)
+		})
+
+		Convey("a decent hash shouldn't collide", func() {
+			h, _ := Get("xxhash64")
+			So(Collisions(h, corpus), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,57 @@
+package hash
+
+import (
+	"encoding/binary"
+	"math/bits"
+)
+
+const (
+	murmurC1 = 0xcc9e2d51
+	murmurC2 = 0x1b873593
+)
+
+// Murmur3 returns the 32-bit (x86) MurmurHash3 of p, with the given seed.
+func Murmur3(p []byte, seed uint32) uint32 {
+	h := seed
+	n := len(p)
+
+	// Body, 4 bytes at a time
+	for len(p) >= 4 {
+		k := binary.LittleEndian.Uint32(p)
+		p = p[4:]
+
+		k *= murmurC1
+		k = bits.RotateLeft32(k, 15)
+		k *= murmurC2
+
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	// Tail, whatever's left
+	var k uint32
+	switch len(p) {
+	case 3:
+		k ^= uint32(p[2]) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(p[1]) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(p[0])
+		k *= murmurC1
+		k = bits.RotateLeft32(k, 15)
+		k *= murmurC2
+		h ^= k
+	}
+
+	// Finalization, to avalanche the bits
+	h ^= uint32(n)
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
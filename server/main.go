@@ -1,15 +1,238 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/hugoamvieira/code-test/server/api"
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+	"github.com/hugoamvieira/code-test/server/ratelimit"
+	"github.com/hugoamvieira/code-test/server/sessionid"
+	"github.com/hugoamvieira/code-test/server/sink"
+	"github.com/hugoamvieira/code-test/server/site"
+	"github.com/hugoamvieira/code-test/server/token"
+	"github.com/hugoamvieira/code-test/server/webhook"
 )
 
 func main() {
+	idleTTL := flag.Duration("idle-ttl", 30*time.Minute, "How long a session can go without events before it's considered abandoned (0 disables it)")
+	completedTTL := flag.Duration("completed-ttl", 10*time.Minute, "How long finished sessions are kept in memory for (0 disables it)")
+	reapInterval := flag.Duration("reap-interval", time.Minute, "How often to look for expired sessions (0 disables it)")
+	datastore := flag.String("datastore", "memory", "Where to keep sessions: 'memory', 'sharded' or 'file'")
+	datastoreDir := flag.String("datastore-dir", "sessions", "Directory for the 'file' datastore")
+	shards := flag.Int("shards", 32, "How many shards the 'sharded' datastore uses")
+	snapshotEvery := flag.Int("snapshot-every", 1000, "How many writes the 'file' datastore logs before taking a snapshot")
+	urlHash := flag.String("url-hash", hash.DefaultHasher, "Algorithm used to hash website URLs ("+strings.Join(hash.Names(), ", ")+")")
+	sinkName := flag.String("sink", "pretty", "Where to write sessions to: 'pretty' (table on stdout), 'ndjson' (stdout) or 'file' (NDJSON)")
+	sinkFile := flag.String("sink-file", "sessions.ndjson", "File for the 'file' sink")
+	sinkFileMaxBytes := flag.Int64("sink-file-max-bytes", 100<<20, "Size at which the 'file' sink rotates its file (0 never rotates)")
+	webhooks := flag.String("webhooks", "", "JSON file with the webhook endpoint of each website (no webhooks if empty)")
+	webhookDir := flag.String("webhook-dir", "webhooks", "Directory for pending webhook deliveries and the dead-letter file")
+	webhookAttempts := flag.Int("webhook-attempts", 10, "How many times a webhook delivery is tried before it's dead-lettered")
+	sites := flag.String("sites", "", "JSON file with the onboarded websites, their site keys and allowed origins (no authentication if empty)")
+	corsOrigins := flag.String("cors-origins", "", "Comma-separated origins allowed on top of the onboarded websites' ('*' allows any)")
+	corsCredentials := flag.Bool("cors-credentials", false, "Allow credentialed (cookies) cross-origin requests")
+	corsMaxAge := flag.Duration("cors-max-age", 10*time.Minute, "How long browsers can cache preflight responses for")
+	ipRate := flag.Float64("ip-rate", 10, "Requests per second allowed per client IP (0 disables it)")
+	ipBurst := flag.Int("ip-burst", 20, "Requests a client IP can make at once")
+	websiteRate := flag.Float64("website-rate", 0, "New sessions and events per second allowed per website (0 disables it)")
+	websiteBurst := flag.Int("website-burst", 1000, "New sessions and events a website can get at once")
+	sessionRate := flag.Float64("session-rate", 5, "Events per second allowed per session (0 disables it)")
+	sessionBurst := flag.Int("session-burst", 20, "Events a session can send at once")
+	trustedProxies := flag.Int("trusted-proxies", 0, "How many proxies in front of the server append to X-Forwarded-For (0 ignores it)")
+	nodeID := flag.Int("node-id", -1, "Node ID (0-65535) in this instance's session IDs, unique per instance (random if negative)")
+	tokenSecretFile := flag.String("token-secret-file", "", "File with the key session tokens are signed with, shared by every instance (random if empty)")
+	tokenMaxAge := flag.Duration("token-max-age", 24*time.Hour, "How long session tokens are valid for (0 never expires them)")
+	adminKeyFile := flag.String("admin-key-file", "", "File with the key required to read sessions, /stream and /debug/vars (they're off if empty)")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "How long to wait for in-flight requests when shutting down")
+	flag.Parse()
+
+	err := hash.SetDefault(*urlHash)
+	if err != nil {
+		log.Fatalf("Unknown URL hash algorithm %q", *urlHash)
+	}
+
+	switch *datastore {
+	case "memory":
+		// This is the default datastore already
+	case "sharded":
+		data.Ds = data.NewDatastoreSharded(*shards)
+	case "file":
+		ds, err := data.NewDatastoreFile(*datastoreDir, *snapshotEvery)
+		if err != nil {
+			log.Fatalln("Failed to open file datastore | Error:", err)
+		}
+		data.Ds = ds
+	default:
+		log.Fatalf("Unknown datastore %q", *datastore)
+	}
+
+	var s sink.Sink
+	switch *sinkName {
+	case "pretty":
+		s = sink.NewTable(os.Stdout)
+	case "ndjson":
+		s = sink.NewNDJSON(os.Stdout)
+	case "file":
+		s, err = sink.NewRotatingFile(*sinkFile, *sinkFileMaxBytes)
+		if err != nil {
+			log.Fatalln("Failed to open sink file | Error:", err)
+		}
+	default:
+		log.Fatalf("Unknown sink %q", *sinkName)
+	}
+
+	// Updates (including the one that completes a session) are written by the API itself,
+	// but abandoned sessions only ever come out of the reaper.
+	data.OnState(data.StateAbandoned, func(d *data.Data) {
+		err := s.Write(d)
+		if err != nil {
+			log.Println("Failed to write session to sink | Error:", err)
+		}
+	})
+
+	var dispatcher *webhook.Dispatcher
+	if *webhooks != "" {
+		endpoints, err := webhook.LoadEndpoints(*webhooks)
+		if err != nil {
+			log.Fatalln("Failed to load webhook endpoints | Error:", err)
+		}
+
+		dispatcher, err = webhook.NewDispatcher(webhook.Config{
+			QueueDir:       filepath.Join(*webhookDir, "queue"),
+			DeadLetterFile: filepath.Join(*webhookDir, "dead-letter.ndjson"),
+			MaxAttempts:    *webhookAttempts,
+			BaseBackoff:    time.Second,
+			MaxBackoff:     10 * time.Minute,
+			Timeout:        10 * time.Second,
+		}, endpoints)
+		if err != nil {
+			log.Fatalln("Failed to start webhook dispatcher | Error:", err)
+		}
+		dispatcher.Start(time.Second)
+
+		data.OnState(data.StateCompleted, func(d *data.Data) {
+			err := dispatcher.Enqueue(d)
+			if err != nil {
+				log.Println("Failed to queue webhook delivery | Error:", err)
+			}
+		})
+	}
+
 	addr := ":5000"
 	a := api.New(addr)
+	a.SetSink(s)
+
+	var tokenKey []byte
+	if *tokenSecretFile != "" {
+		tokenKey, err = ioutil.ReadFile(*tokenSecretFile)
+		if err != nil {
+			log.Fatalln("Failed to read token secret | Error:", err)
+		}
+	} else {
+		log.Println("No -token-secret-file given, session tokens won't survive a restart")
+		tokenKey, err = token.RandomKey()
+		if err != nil {
+			log.Fatalln("Failed to generate token secret | Error:", err)
+		}
+	}
+	a.SetTokenSigner(token.NewSigner(tokenKey, *tokenMaxAge))
+
+	if *adminKeyFile != "" {
+		adminKey, err := ioutil.ReadFile(*adminKeyFile)
+		if err != nil {
+			log.Fatalln("Failed to read admin key | Error:", err)
+		}
+		a.SetAdminKey(strings.TrimSpace(string(adminKey)))
+	} else {
+		log.Println("No -admin-key-file given, sessions can't be read through the API")
+	}
+
+	if *nodeID >= 0 {
+		if *nodeID > math.MaxUint16 {
+			log.Fatalf("Node ID %v is out of range", *nodeID)
+		}
+		a.SetSessionIDs(sessionid.NewGenerator(uint16(*nodeID)))
+	}
+
+	policy := api.CORSPolicy{
+		AllowCredentials: *corsCredentials,
+		MaxAge:           *corsMaxAge,
+	}
+	if *corsOrigins != "" {
+		policy.AllowedOrigins = strings.Split(*corsOrigins, ",")
+	}
+	if policy.AllowCredentials && policy.AllowsAnyOrigin(*sites != "") {
+		log.Fatalln("-cors-credentials needs the allowed origins to be listed (in -cors-origins, without '*', or -sites)")
+	}
+	a.SetCORSPolicy(policy)
+
+	a.SetRateLimits(api.RateLimits{
+		IP:             ratelimit.Limit{Rate: *ipRate, Burst: *ipBurst},
+		Website:        ratelimit.Limit{Rate: *websiteRate, Burst: *websiteBurst},
+		Session:        ratelimit.Limit{Rate: *sessionRate, Burst: *sessionBurst},
+		TrustedProxies: *trustedProxies,
+	})
+
+	if *sites != "" {
+		ss, err := site.LoadSites(*sites)
+		if err != nil {
+			log.Fatalln("Failed to load sites | Error:", err)
+		}
+		reg, err := site.NewRegistry(ss)
+		if err != nil {
+			log.Fatalln("Failed to load sites | Error:", err)
+		}
+		a.SetSites(reg)
+	} else {
+		log.Println("No -sites given, requests from any website will be accepted")
+	}
+
+	a.StartReaper(*reapInterval, data.Expiry{
+		Idle:      *idleTTL,
+		Completed: *completedTTL,
+	})
+
+	go func() {
+		log.Printf("Starting API on %v\n", addr)
+		err := a.Start()
+		if err != http.ErrServerClosed {
+			log.Fatalln(err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Printf("Got %v, shutting down", <-sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
 
-	log.Printf("Starting API on %v\n", addr)
-	log.Fatalln(a.Start())
+	// The API goes first, so nothing else gets written to the sink, the webhooks or the datastore.
+	err = a.Shutdown(ctx)
+	if err != nil {
+		log.Println("Failed to shut down API cleanly | Error:", err)
+	}
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+	if c, ok := data.Ds.(io.Closer); ok {
+		err = c.Close()
+		if err != nil {
+			log.Println("Failed to close datastore | Error:", err)
+		}
+	}
+	log.Println("Bye!")
 }
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneInterval is how often a limiter forgets about the keys whose buckets have filled back up.
+// A full bucket is no different from one that doesn't exist, so there's no point keeping it around.
+const pruneInterval = time.Minute
+
+// Limit is how fast requests can be made. Every key can make up to Burst requests at once, and
+// then Rate requests per second after that. A zero Limit doesn't limit anything.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited tells whether the limit lets everything through.
+func (l Limit) Unlimited() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket rate limiter, with one bucket per key (eg: per IP).
+type Limiter struct {
+	limit Limit
+
+	buckets   map[string]*bucket
+	lastPrune time.Time
+	mu        sync.Mutex
+}
+
+// New returns a limiter that limits every key to l.
+func New(l Limit) *Limiter {
+	return &Limiter{
+		limit:   l,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from key's bucket. If there aren't any left, it returns false and how long
+// until there will be one.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	return l.AllowAt(key, time.Now())
+}
+
+// AllowAt is Allow, at a given time.
+func (l *Limiter) AllowAt(key string, now time.Time) (bool, time.Duration) {
+	if l.limit.Unlimited() {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{
+			tokens: float64(l.limit.Burst),
+			last:   now,
+		}
+		l.buckets[key] = b
+	}
+	b.refill(now, l.limit)
+
+	if b.tokens < 1 {
+		wait := (1 - b.tokens) / l.limit.Rate
+		return false, time.Duration(math.Ceil(wait * float64(time.Second)))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// Len returns how many keys the limiter is keeping track of.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+func (l *Limiter) prune(now time.Time) {
+	for key, b := range l.buckets {
+		b.refill(now, l.limit)
+		if b.tokens >= float64(l.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastPrune = now
+}
+
+func (b *bucket) refill(now time.Time, l Limit) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.tokens = math.Min(float64(l.Burst), b.tokens+elapsed*l.Rate)
+	b.last = now
+}
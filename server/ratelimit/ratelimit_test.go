@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestLimiter(t *testing.T) {
+	Convey("Given a limiter of 1 request per second, with bursts of 2", t, func() {
+		l := New(Limit{Rate: 1, Burst: 2})
+		now := time.Now()
+
+		Convey("a key should be able to burst and then be limited", func() {
+			ok, _ := l.AllowAt("a", now)
+			So(ok, ShouldBeTrue)
+			ok, _ = l.AllowAt("a", now)
+			So(ok, ShouldBeTrue)
+
+			ok, retryAfter := l.AllowAt("a", now)
+			So(ok, ShouldBeFalse)
+			So(retryAfter, ShouldEqual, time.Second)
+
+			Convey("while other keys aren't", func() {
+				ok, _ := l.AllowAt("b", now)
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("until its bucket refills", func() {
+				ok, retryAfter := l.AllowAt("a", now.Add(500*time.Millisecond))
+				So(ok, ShouldBeFalse)
+				So(retryAfter, ShouldEqual, 500*time.Millisecond)
+
+				ok, _ = l.AllowAt("a", now.Add(time.Second))
+				So(ok, ShouldBeTrue)
+			})
+
+			Convey("and its bucket should be forgotten once it's full again", func() {
+				l.AllowAt("b", now.Add(time.Minute))
+				So(l.Len(), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a zero limit", t, func() {
+		l := New(Limit{})
+
+		Convey("nothing should be limited", func() {
+			for i := 0; i < 100; i++ {
+				ok, _ := l.Allow("a")
+				So(ok, ShouldBeTrue)
+			}
+			So(l.Len(), ShouldEqual, 0)
+		})
+	})
+}
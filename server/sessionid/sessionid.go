@@ -0,0 +1,92 @@
+package sessionid
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	timeBytes   = 6 // Milliseconds since the Unix epoch, good until the year 10889.
+	nodeBytes   = 2
+	randomBytes = 8
+	idBytes     = timeBytes + nodeBytes + randomBytes
+)
+
+// encoding is base32 with the "extended hex" alphabet, which sorts in the same order as the
+// bytes it encodes, so IDs sort by time as strings too.
+var encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+var errInvalidID = errors.New("Invalid session ID")
+
+// Generator generates K-sortable session IDs: the time the ID was generated at, followed by
+// the node (server instance) that generated it and some randomness from crypto/rand.
+// IDs are unguessable, roughly ordered by time and, as long as every instance has a different
+// node, unique across instances without having to keep track of the ones handed out.
+type Generator struct {
+	node uint16
+	rand io.Reader
+}
+
+// NewGenerator returns a generator for the given node.
+func NewGenerator(node uint16) *Generator {
+	return &Generator{
+		node: node,
+		rand: rand.Reader,
+	}
+}
+
+// RandomNode picks a random node, for when there's only one instance or nobody's assigned them.
+// With a handful of instances, it's very unlikely that two of them get the same node, and
+// even then they'd have to generate the same 64 random bits in the same millisecond.
+func RandomNode() (uint16, error) {
+	var b [nodeBytes]byte
+	_, err := io.ReadFull(rand.Reader, b[:])
+	if err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+// New returns a new session ID.
+func (g *Generator) New() (string, error) {
+	return g.NewAt(time.Now())
+}
+
+// NewAt returns a new session ID generated at the given time.
+func (g *Generator) NewAt(t time.Time) (string, error) {
+	var b [idBytes]byte
+
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := timeBytes - 1; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	binary.BigEndian.PutUint16(b[timeBytes:], g.node)
+
+	_, err := io.ReadFull(g.rand, b[timeBytes+nodeBytes:])
+	if err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(b[:]), nil
+}
+
+// Parse returns the time and node a session ID was generated at.
+func Parse(id string) (time.Time, uint16, error) {
+	b, err := encoding.DecodeString(id)
+	if err != nil || len(b) != idBytes {
+		return time.Time{}, 0, errInvalidID
+	}
+
+	var ms uint64
+	for i := 0; i < timeBytes; i++ {
+		ms = ms<<8 | uint64(b[i])
+	}
+	node := binary.BigEndian.Uint16(b[timeBytes:])
+
+	return time.Unix(0, int64(ms)*int64(time.Millisecond)), node, nil
+}
@@ -0,0 +1,71 @@
+package sessionid
+
+import (
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestGenerator(t *testing.T) {
+	Convey("Given a generator", t, func() {
+		g := NewGenerator(42)
+
+		Convey("an ID should carry the time and node it was generated at", func() {
+			now := time.Now()
+			id, err := g.NewAt(now)
+			So(err, ShouldBeNil)
+			So(len(id), ShouldEqual, 26)
+
+			at, node, err := Parse(id)
+			So(err, ShouldBeNil)
+			So(node, ShouldEqual, 42)
+			So(at.Equal(now.Truncate(time.Millisecond)), ShouldBeTrue)
+		})
+
+		Convey("IDs should sort by the time they were generated at", func() {
+			start := time.Now()
+			var ids []string
+			for i := 0; i < 100; i++ {
+				id, err := g.NewAt(start.Add(time.Duration(99-i) * time.Millisecond))
+				So(err, ShouldBeNil)
+				ids = append(ids, id)
+			}
+
+			So(sort.StringsAreSorted(ids), ShouldBeFalse)
+			sort.Strings(ids)
+			for i := 1; i < len(ids); i++ {
+				prev, _, _ := Parse(ids[i-1])
+				cur, _, _ := Parse(ids[i])
+				So(prev.Before(cur), ShouldBeTrue)
+			}
+		})
+
+		Convey("IDs generated at the same time shouldn't collide", func() {
+			now := time.Now()
+			seen := make(map[string]bool)
+			for i := 0; i < 10000; i++ {
+				id, err := g.NewAt(now)
+				So(err, ShouldBeNil)
+				seen[id] = true
+			}
+			So(len(seen), ShouldEqual, 10000)
+		})
+
+		Convey("if there's no randomness, it should fail", func() {
+			g.rand = bytes.NewReader(nil)
+			id, err := g.New()
+			So(err, ShouldNotBeNil)
+			So(id, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Parsing something that isn't a session ID should fail", t, func() {
+		for _, id := range []string{"", "1234567890", "not base32!"} {
+			_, _, err := Parse(id)
+			So(err, ShouldEqual, errInvalidID)
+		}
+	})
+}
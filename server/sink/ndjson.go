@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+// NDJSON writes every record as a line of JSON (http://ndjson.org) to a writer (eg: stdout).
+type NDJSON struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// NewNDJSON returns a sink that writes to w.
+func NewNDJSON(w io.Writer) *NDJSON {
+	return &NDJSON{
+		w: w,
+	}
+}
+
+// Write writes the record as a single line.
+func (s *NDJSON) Write(d *data.Data) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err = s.w.Write(append(b, '\n'))
+	return err
+}
+
+// Close does nothing, as the writer isn't ours to close.
+func (s *NDJSON) Close() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+// RotatingFile writes every record as a line of JSON to a file. Once the file grows past a
+// given size, it's renamed (with the time of the rotation as a suffix) and a new one is started.
+type RotatingFile struct {
+	path     string
+	maxBytes int64
+
+	f    *os.File
+	size int64
+	mu   sync.Mutex
+}
+
+// NewRotatingFile returns a sink that appends to the file at path, rotating it once it's
+// bigger than maxBytes. A maxBytes of 0 or less never rotates.
+func NewRotatingFile(path string, maxBytes int64) (*RotatingFile, error) {
+	s := &RotatingFile{
+		path:     path,
+		maxBytes: maxBytes,
+	}
+
+	err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Write appends the record to the file, rotating it first if it's too big.
+func (s *RotatingFile) Write(d *data.Data) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxBytes > 0 && s.size > 0 && s.size+int64(len(b)) > s.maxBytes {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	n, err := s.f.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+// Close closes the current file.
+func (s *RotatingFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.f.Close()
+}
+
+func (s *RotatingFile) open() error {
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	s.f = f
+	s.size = info.Size()
+	return nil
+}
+
+// rotate must be called with the lock held.
+// The file is renamed before it's closed, so if that fails we still have it to write to
+// (and rotating is tried again on the next write).
+func (s *RotatingFile) rotate() error {
+	rotated := fmt.Sprintf("%v.%v", s.path, time.Now().UTC().Format("20060102T150405.000000000"))
+	err := os.Rename(s.path, rotated)
+	if err != nil {
+		return err
+	}
+
+	old := s.f
+	err = s.open()
+	if err != nil {
+		// Keep writing to the rotated one, there's nowhere else
+		return err
+	}
+	return old.Close()
+}
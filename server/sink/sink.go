@@ -0,0 +1,40 @@
+package sink
+
+import (
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+// Sink is where session records are written to, every time they change.
+// Implementations must be thread-safe, as records are written from every request handler.
+type Sink interface {
+	Write(d *data.Data) error
+	Close() error
+}
+
+// Multi writes every record to all of the given sinks. It carries on writing to the rest
+// if one of them fails, and returns the first error it got.
+type Multi []Sink
+
+// Write writes the record to every sink.
+func (m Multi) Write(d *data.Data) error {
+	var firstErr error
+	for _, s := range m {
+		err := s.Write(d)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Close closes every sink.
+func (m Multi) Close() error {
+	var firstErr error
+	for _, s := range m {
+		err := s.Close()
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
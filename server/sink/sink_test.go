@@ -0,0 +1,165 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func testRecord() *data.Data {
+	return &data.Data{
+		WebsiteURL:         "https://www.website.com",
+		SessionID:          "session",
+		ResizeFrom:         data.Dimension{Width: 100, Height: 200},
+		ResizeTo:           data.Dimension{Width: 101, Height: 201},
+		CopyAndPaste:       map[string]data.CopyPaste{"inputCVV": data.NewCopyPaste(data.ClipboardPaste, 3, true), "inputCardNumber": data.NewCopyPaste(data.ClipboardPaste, 16, true)},
+		Keystrokes:         map[string]data.Keystrokes{"inputName": data.NewKeystrokes([]data.Keystroke{{DownAt: 1000}, {DownAt: 1200, Backspace: true}})},
+		FormCompletionTime: 10,
+		State:              data.StateCompleted,
+		UpdatedAt:          time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestNDJSON(t *testing.T) {
+	Convey("Given an NDJSON sink", t, func() {
+		var buf bytes.Buffer
+		s := NewNDJSON(&buf)
+
+		Convey("every record should be written as its own line of JSON", func() {
+			So(s.Write(testRecord()), ShouldBeNil)
+			So(s.Write(testRecord()), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(len(lines), ShouldEqual, 2)
+
+			var d data.Data
+			So(json.Unmarshal([]byte(lines[0]), &d), ShouldBeNil)
+			So(d, ShouldResemble, *testRecord())
+			So(lines[0], ShouldContainSubstring, `"state":"completed"`)
+		})
+	})
+}
+
+func TestRotatingFile(t *testing.T) {
+	Convey("Given a rotating file sink with a small size limit", t, func() {
+		dir, err := ioutil.TempDir("", "sink")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "sessions.ndjson")
+		s, err := NewRotatingFile(path, 10)
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		Convey("writing past the limit should rotate the file", func() {
+			So(s.Write(testRecord()), ShouldBeNil)
+			So(s.Write(testRecord()), ShouldBeNil)
+
+			files, err := filepath.Glob(path + "*")
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 2)
+
+			b, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+		})
+
+		Convey("a failed rotation shouldn't stop later writes", func() {
+			So(s.Write(testRecord()), ShouldBeNil)
+
+			// Renaming a file that isn't there fails
+			So(os.Remove(path), ShouldBeNil)
+			So(s.Write(testRecord()), ShouldNotBeNil)
+
+			So(ioutil.WriteFile(path, nil, 0644), ShouldBeNil)
+			So(s.Write(testRecord()), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given a rotating file sink without a size limit", t, func() {
+		dir, err := ioutil.TempDir("", "sink")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "sessions.ndjson")
+		s, err := NewRotatingFile(path, 0)
+		So(err, ShouldBeNil)
+
+		Convey("it should keep appending to the same file, even after reopening", func() {
+			So(s.Write(testRecord()), ShouldBeNil)
+			So(s.Close(), ShouldBeNil)
+
+			s, err = NewRotatingFile(path, 0)
+			So(err, ShouldBeNil)
+			So(s.Write(testRecord()), ShouldBeNil)
+			So(s.Close(), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(path)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(b), "\n"), ShouldEqual, 2)
+		})
+	})
+}
+
+func TestTable(t *testing.T) {
+	Convey("Given a table sink", t, func() {
+		var buf bytes.Buffer
+		s := NewTable(&buf)
+
+		Convey("it should write a header and then one row per record", func() {
+			So(s.Write(testRecord()), ShouldBeNil)
+			So(s.Write(&data.Data{WebsiteURL: "https://www.website.com", SessionID: "other"}), ShouldBeNil)
+
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			So(len(lines), ShouldEqual, 3)
+			So(lines[0], ShouldStartWith, "UPDATED")
+			So(lines[1], ShouldContainSubstring, "completed")
+			So(lines[1], ShouldContainSubstring, "100x200 -> 101x201")
+			So(lines[1], ShouldContainSubstring, "inputCVV,inputCardNumber")
+			So(lines[1], ShouldContainSubstring, "2 (1 backspace(s), 200ms apart)")
+			So(lines[1], ShouldContainSubstring, "10s")
+			So(lines[2], ShouldContainSubstring, "created")
+		})
+	})
+}
+
+type failingSink struct {
+	writes int
+}
+
+func (s *failingSink) Write(d *data.Data) error {
+	s.writes++
+	return errors.New("failed")
+}
+
+func (s *failingSink) Close() error {
+	return nil
+}
+
+func TestMulti(t *testing.T) {
+	Convey("Given a multi sink where one of the sinks fails", t, func() {
+		var buf bytes.Buffer
+		failing := &failingSink{}
+		s := Multi{failing, NewNDJSON(&buf)}
+
+		Convey("the record should still reach the other sinks, and the error be returned", func() {
+			So(s.Write(testRecord()), ShouldNotBeNil)
+			So(failing.writes, ShouldEqual, 1)
+			So(buf.Len(), ShouldBeGreaterThan, 0)
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+)
+
+// Table writes every record as a row of a human-readable table.
+// The header is written before the first row.
+type Table struct {
+	tw          *tabwriter.Writer
+	wroteHeader bool
+	mu          sync.Mutex
+}
+
+// NewTable returns a sink that writes a table to w.
+func NewTable(w io.Writer) *Table {
+	return &Table{
+		tw: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0),
+	}
+}
+
+// Write writes the record as a row. Rows are flushed straight away, so columns are only
+// aligned within the header and the row itself.
+func (s *Table) Write(d *data.Data) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.wroteHeader {
+		fmt.Fprintln(s.tw, "UPDATED\tSTATE\tWEBSITE\tSESSION\tRESIZE\tCOPY & PASTE\tKEYSTROKES\tFORM TIME")
+		s.wroteHeader = true
+	}
+
+	fmt.Fprintf(s.tw, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n",
+		d.UpdatedAt.Format(time.RFC3339),
+		d.State,
+		d.WebsiteURL,
+		d.SessionID,
+		formatResize(d),
+		formatCopyAndPaste(d),
+		formatKeystrokes(d),
+		formatFormTime(d),
+	)
+	return s.tw.Flush()
+}
+
+// Close flushes whatever is left.
+func (s *Table) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tw.Flush()
+}
+
+func formatResize(d *data.Data) string {
+	if d.ResizeFrom.IsZero() {
+		return "-"
+	}
+	resize := fmt.Sprintf("%vx%v -> %vx%v", d.ResizeFrom.Width, d.ResizeFrom.Height, d.ResizeTo.Width, d.ResizeTo.Height)
+	if d.ResizeCount > 1 {
+		resize += fmt.Sprintf(" (+%v more)", d.ResizeCount-1)
+	}
+	return resize
+}
+
+func formatCopyAndPaste(d *data.Data) string {
+	if len(d.CopyAndPaste) == 0 {
+		return "-"
+	}
+
+	fields := make([]string, 0, len(d.CopyAndPaste))
+	for field, cp := range d.CopyAndPaste {
+		if n := cp.Count(); n > 1 {
+			field = fmt.Sprintf("%v(x%v)", field, n)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return strings.Join(fields, ",")
+}
+
+func formatKeystrokes(d *data.Data) string {
+	if len(d.Keystrokes) == 0 {
+		return "-"
+	}
+
+	var keys, backspaces int
+	var interKey data.Stats
+	for _, k := range d.Keystrokes {
+		keys += k.Count
+		backspaces += k.Backspaces
+		interKey = interKey.Merge(k.InterKeyMs)
+	}
+	return fmt.Sprintf("%v (%v backspace(s), %.0fms apart)", keys, backspaces, interKey.Mean())
+}
+
+func formatFormTime(d *data.Data) string {
+	if d.FormCompletionTimeMs > 0 {
+		return fmt.Sprintf("%.3fs", float64(d.FormCompletionTimeMs)/1000)
+	}
+	if d.FormCompletionTime == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%vs", d.FormCompletionTime)
+}
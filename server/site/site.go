@@ -0,0 +1,196 @@
+package site
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+)
+
+// KeyHeader is the header the JS client sends the site key in.
+const KeyHeader = "X-Site-Key"
+
+var (
+	// ErrUnknownKey is returned when the site key isn't one of an onboarded website.
+	ErrUnknownKey = errors.New("Unknown site key")
+	// ErrOriginNotAllowed is returned when the request comes from an origin the website didn't allow.
+	ErrOriginNotAllowed = errors.New("Origin not allowed for site")
+	// ErrURLNotAllowed is returned when the website URL doesn't belong to the site.
+	ErrURLNotAllowed = errors.New("Website URL doesn't belong to site")
+
+	errEmptyKey   = errors.New("Site key can't be empty")
+	errKeyExists  = errors.New("Site key already exists")
+	errInvalidURL = errors.New("Site website URL must be absolute")
+)
+
+// Site is an onboarded website.
+type Site struct {
+	// Key is the public key the JS client identifies the website with. It's not a secret,
+	// as it's shipped with the website's JS, which is why it's checked along with the origin.
+	Key string `json:"key"`
+	// WebsiteURL is where the website lives. Sessions can be created for it and any page under it.
+	WebsiteURL string `json:"websiteURL"`
+	// Origins are the origins requests are allowed from. If empty, only the origin of WebsiteURL is.
+	Origins []string `json:"origins"`
+}
+
+// AllowsOrigin tells whether the site accepts requests from origin (eg: https://www.website.com).
+func (s Site) AllowsOrigin(origin string) bool {
+	if origin == "" {
+		return false
+	}
+
+	origins := s.Origins
+	if len(origins) == 0 {
+		origins = []string{originOf(s.WebsiteURL)}
+	}
+	for _, o := range origins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Owns tells whether websiteURL is the site's URL or a page under it.
+// eg: https://www.website.com/shop owns https://www.website.com/shop/checkout?step=2, but not
+// https://www.website.com/blog or http://www.website.com/shop.
+func (s Site) Owns(websiteURL string) bool {
+	site, err := url.Parse(s.WebsiteURL)
+	if err != nil {
+		return false
+	}
+	u, err := url.Parse(websiteURL)
+	if err != nil {
+		return false
+	}
+
+	if !strings.EqualFold(u.Scheme, site.Scheme) || !strings.EqualFold(u.Host, site.Host) {
+		return false
+	}
+
+	// Otherwise https://www.website.com/shop/../admin would be under /shop
+	urlPath := u.Path
+	if urlPath != "" {
+		urlPath = path.Clean(urlPath)
+	}
+
+	sitePath := strings.TrimSuffix(site.Path, "/")
+	return urlPath == sitePath || strings.HasPrefix(urlPath, sitePath+"/")
+}
+
+func originOf(websiteURL string) string {
+	u, err := url.Parse(websiteURL)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Registry holds every onboarded website, by site key.
+type Registry struct {
+	sites map[string]Site
+	mu    sync.RWMutex
+}
+
+// NewRegistry returns a registry with the given sites in it.
+func NewRegistry(sites []Site) (*Registry, error) {
+	r := &Registry{
+		sites: make(map[string]Site, len(sites)),
+	}
+	for _, s := range sites {
+		err := r.Add(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// LoadSites reads a JSON array of sites from a file.
+func LoadSites(path string) ([]Site, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []Site
+	err = json.Unmarshal(b, &sites)
+	if err != nil {
+		return nil, err
+	}
+	return sites, nil
+}
+
+// Add onboards a website.
+func (r *Registry) Add(s Site) error {
+	if s.Key == "" {
+		return errEmptyKey
+	}
+	u, err := url.Parse(s.WebsiteURL)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return errInvalidURL
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sites[s.Key]; ok {
+		return errKeyExists
+	}
+	r.sites[s.Key] = s
+	return nil
+}
+
+// Get returns the site with the given key.
+func (r *Registry) Get(key string) (Site, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	s, ok := r.sites[key]
+	return s, ok
+}
+
+// Sites returns every onboarded website.
+func (r *Registry) Sites() []Site {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	sites := make([]Site, 0, len(r.sites))
+	for _, s := range r.sites {
+		sites = append(sites, s)
+	}
+	return sites
+}
+
+// AllowsOrigin tells whether any of the onboarded websites accepts requests from origin.
+func (r *Registry) AllowsOrigin(origin string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.sites {
+		if s.AllowsOrigin(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticate checks that a request with the given site key, coming from origin, is allowed
+// to create sessions or send events for websiteURL.
+func (r *Registry) Authenticate(key, origin, websiteURL string) (Site, error) {
+	s, ok := r.Get(key)
+	if !ok {
+		return Site{}, ErrUnknownKey
+	}
+	if !s.AllowsOrigin(origin) {
+		return Site{}, ErrOriginNotAllowed
+	}
+	if !s.Owns(websiteURL) {
+		return Site{}, ErrURLNotAllowed
+	}
+	return s, nil
+}
@@ -0,0 +1,87 @@
+package site
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSiteOwns(t *testing.T) {
+	Convey("Given a site under a path", t, func() {
+		s := Site{Key: "k", WebsiteURL: "https://www.website.com/shop/"}
+
+		Convey("it should own itself and the pages under it", func() {
+			So(s.Owns("https://www.website.com/shop"), ShouldBeTrue)
+			So(s.Owns("https://www.website.com/shop/"), ShouldBeTrue)
+			So(s.Owns("https://www.website.com/shop/checkout?step=2"), ShouldBeTrue)
+		})
+
+		Convey("it shouldn't own other paths, schemes or hosts", func() {
+			So(s.Owns("https://www.website.com/shopping"), ShouldBeFalse)
+			So(s.Owns("https://www.website.com/blog"), ShouldBeFalse)
+			So(s.Owns("http://www.website.com/shop"), ShouldBeFalse)
+			So(s.Owns("https://evil.com/shop"), ShouldBeFalse)
+			So(s.Owns("https://www.website.com.evil.com/shop"), ShouldBeFalse)
+		})
+
+		Convey("it shouldn't own paths that only look like they're under it", func() {
+			So(s.Owns("https://www.website.com/shop/../admin"), ShouldBeFalse)
+			So(s.Owns("https://www.website.com/shop/%2e%2e/admin"), ShouldBeFalse)
+			So(s.Owns("https://www.website.com/shop/./checkout/../cart"), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSiteAllowsOrigin(t *testing.T) {
+	Convey("Given a site without any origins", t, func() {
+		s := Site{Key: "k", WebsiteURL: "https://www.website.com/shop"}
+
+		Convey("it should only allow its own origin", func() {
+			So(s.AllowsOrigin("https://www.website.com"), ShouldBeTrue)
+			So(s.AllowsOrigin("https://evil.com"), ShouldBeFalse)
+			So(s.AllowsOrigin(""), ShouldBeFalse)
+		})
+
+		Convey("with origins, it should only allow those", func() {
+			s.Origins = []string{"https://cdn.website.com"}
+			So(s.AllowsOrigin("https://cdn.website.com"), ShouldBeTrue)
+			So(s.AllowsOrigin("https://www.website.com"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestRegistry(t *testing.T) {
+	Convey("Given a registry with a site", t, func() {
+		r, err := NewRegistry([]Site{{Key: "key1", WebsiteURL: "https://www.website.com"}})
+		So(err, ShouldBeNil)
+
+		Convey("a request with its key, origin and a page of it should be authenticated", func() {
+			s, err := r.Authenticate("key1", "https://www.website.com", "https://www.website.com/checkout")
+			So(err, ShouldBeNil)
+			So(s.Key, ShouldEqual, "key1")
+		})
+
+		Convey("a request with anything not matching should be rejected", func() {
+			_, err := r.Authenticate("nope", "https://www.website.com", "https://www.website.com/checkout")
+			So(err, ShouldEqual, ErrUnknownKey)
+
+			_, err = r.Authenticate("key1", "https://evil.com", "https://www.website.com/checkout")
+			So(err, ShouldEqual, ErrOriginNotAllowed)
+
+			_, err = r.Authenticate("key1", "https://www.website.com", "https://evil.com/checkout")
+			So(err, ShouldEqual, ErrURLNotAllowed)
+		})
+
+		Convey("it should allow the site's origin and nothing else", func() {
+			So(r.AllowsOrigin("https://www.website.com"), ShouldBeTrue)
+			So(r.AllowsOrigin("https://evil.com"), ShouldBeFalse)
+		})
+
+		Convey("adding an invalid or existing site should fail", func() {
+			So(r.Add(Site{Key: "key1", WebsiteURL: "https://other.com"}), ShouldEqual, errKeyExists)
+			So(r.Add(Site{WebsiteURL: "https://other.com"}), ShouldEqual, errEmptyKey)
+			So(r.Add(Site{Key: "key2", WebsiteURL: "/relative"}), ShouldEqual, errInvalidURL)
+			So(len(r.Sites()), ShouldEqual, 1)
+		})
+	})
+}
@@ -0,0 +1,114 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header is the header the JS client sends the session token in.
+const Header = "X-Session-Token"
+
+var (
+	// ErrInvalid is returned for tokens that are malformed or weren't signed by us.
+	ErrInvalid = errors.New("Invalid session token")
+	// ErrExpired is returned for tokens that were issued too long ago.
+	ErrExpired = errors.New("Session token has expired")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Claims is what a token says about its holder: which session of which website it's for,
+// and when it was given to them.
+type Claims struct {
+	SessionID      string
+	WebsiteURLHash string
+	IssuedAt       time.Time
+}
+
+// Signer issues and verifies session tokens. A token is the claims, base64 encoded, followed by
+// their HMAC-SHA256, so they can be checked without looking anything up.
+type Signer struct {
+	key    []byte
+	maxAge time.Duration
+}
+
+// NewSigner returns a signer using key, whose tokens are valid for maxAge (forever, if 0).
+// Every instance behind the same load balancer must use the same key.
+func NewSigner(key []byte, maxAge time.Duration) *Signer {
+	return &Signer{
+		key:    key,
+		maxAge: maxAge,
+	}
+}
+
+// RandomKey returns a new random key. Tokens signed with it won't be valid after a restart,
+// nor on any other instance.
+func RandomKey() ([]byte, error) {
+	key := make([]byte, sha256.Size)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Sign returns the token for c.
+func (s *Signer) Sign(c Claims) string {
+	payload := strings.Join([]string{
+		c.SessionID,
+		c.WebsiteURLHash,
+		strconv.FormatInt(c.IssuedAt.Unix(), 10),
+	}, ".")
+
+	p := encoding.EncodeToString([]byte(payload))
+	return p + "." + encoding.EncodeToString(s.mac(p))
+}
+
+// Verify checks that token was signed by us and hasn't expired, and returns its claims.
+func (s *Signer) Verify(token string, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return Claims{}, ErrInvalid
+	}
+
+	mac, err := encoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(mac, s.mac(parts[0])) {
+		return Claims{}, ErrInvalid
+	}
+
+	payload, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 3 {
+		return Claims{}, ErrInvalid
+	}
+	issuedAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return Claims{}, ErrInvalid
+	}
+
+	c := Claims{
+		SessionID:      fields[0],
+		WebsiteURLHash: fields[1],
+		IssuedAt:       time.Unix(issuedAt, 0),
+	}
+	if s.maxAge > 0 && now.Sub(c.IssuedAt) > s.maxAge {
+		return Claims{}, ErrExpired
+	}
+	return c, nil
+}
+
+func (s *Signer) mac(payload string) []byte {
+	m := hmac.New(sha256.New, s.key)
+	m.Write([]byte(payload))
+	return m.Sum(nil)
+}
@@ -0,0 +1,52 @@
+package token
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSigner(t *testing.T) {
+	Convey("Given a signer and a token it issued", t, func() {
+		s := NewSigner([]byte("key"), time.Hour)
+		now := time.Now()
+		c := Claims{
+			SessionID:      "session1",
+			WebsiteURLHash: "1a2b3c4d",
+			IssuedAt:       now.Truncate(time.Second),
+		}
+		tok := s.Sign(c)
+
+		Convey("verifying it should give back its claims", func() {
+			got, err := s.Verify(tok, now)
+			So(err, ShouldBeNil)
+			So(got.SessionID, ShouldEqual, c.SessionID)
+			So(got.WebsiteURLHash, ShouldEqual, c.WebsiteURLHash)
+			So(got.IssuedAt.Equal(c.IssuedAt), ShouldBeTrue)
+		})
+
+		Convey("after its max age, it should be expired", func() {
+			_, err := s.Verify(tok, now.Add(2*time.Hour))
+			So(err, ShouldEqual, ErrExpired)
+		})
+
+		Convey("a signer with another key shouldn't accept it", func() {
+			_, err := NewSigner([]byte("other"), time.Hour).Verify(tok, now)
+			So(err, ShouldEqual, ErrInvalid)
+		})
+
+		Convey("tampering with it should make it invalid", func() {
+			forged := Claims{SessionID: "session2", WebsiteURLHash: c.WebsiteURLHash, IssuedAt: c.IssuedAt}
+			sig := tok[strings.Index(tok, ".")+1:]
+			otherPayload := NewSigner([]byte("other"), 0).Sign(forged)
+			otherPayload = otherPayload[:strings.Index(otherPayload, ".")]
+
+			for _, bad := range []string{"", "nope", tok + ".x", otherPayload + "." + sig, tok[:len(tok)-2]} {
+				_, err := s.Verify(bad, now)
+				So(err, ShouldEqual, ErrInvalid)
+			}
+		})
+	})
+}
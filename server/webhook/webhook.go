@@ -0,0 +1,367 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+)
+
+const (
+	// SignatureHeader carries the HMAC-SHA256 of the request body, keyed with the endpoint's secret,
+	// as `sha256=<hex>`. Receivers should compute it themselves and compare.
+	SignatureHeader = "X-Webhook-Signature"
+	// DeliveryHeader carries the delivery ID, which stays the same across retries.
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	deliveryFileExt = ".json"
+)
+
+var (
+	errDeliveryFailed = errors.New("Webhook receiver didn't accept the delivery")
+	errNoEndpoint     = errors.New("Website no longer has a webhook endpoint")
+)
+
+// Endpoint is where a website's completed sessions are delivered to.
+type Endpoint struct {
+	WebsiteURL string `json:"websiteURL"`
+	URL        string `json:"url"`
+	Secret     string `json:"secret"`
+}
+
+// Payload is what gets POSTed to the endpoint.
+type Payload struct {
+	WebsiteURLHash string     `json:"websiteURLHash"`
+	Session        *data.Data `json:"session"`
+}
+
+// delivery is a payload waiting to be delivered. Every delivery is kept in its own file in the
+// queue directory until it's either delivered or given up on, so restarts don't lose any.
+// Only the website is kept, not its endpoint: the URL and secret are looked up when sending, so
+// they never end up on disk (or in the dead letters) and config changes apply to queued deliveries.
+type delivery struct {
+	ID          string          `json:"id"`
+	WebsiteURL  string          `json:"websiteURL"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+	LastError   string          `json:"lastError,omitempty"`
+}
+
+// Config holds how deliveries are made and retried.
+type Config struct {
+	// QueueDir is where pending deliveries are kept.
+	QueueDir string
+	// DeadLetterFile is where deliveries that ran out of attempts are appended to (as NDJSON).
+	DeadLetterFile string
+	// MaxAttempts is how many times a delivery is tried before it's dead-lettered.
+	MaxAttempts int
+	// BaseBackoff is how long to wait after the first failure. It doubles after every
+	// failure, up to MaxBackoff.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Timeout is how long to wait for the receiver to respond.
+	Timeout time.Duration
+}
+
+// Dispatcher delivers completed sessions to their website's webhook endpoint, retrying with
+// exponential backoff until it either succeeds or runs out of attempts.
+type Dispatcher struct {
+	cfg       Config
+	endpoints map[string]Endpoint
+	client    *http.Client
+
+	pending map[string]*delivery
+	nextID  uint64
+	mu      sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewDispatcher returns a dispatcher for the given endpoints, loading whatever deliveries
+// were still pending in the queue directory.
+func NewDispatcher(cfg Config, endpoints []Endpoint) (*Dispatcher, error) {
+	err := os.MkdirAll(cfg.QueueDir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dispatcher{
+		cfg:       cfg,
+		endpoints: make(map[string]Endpoint, len(endpoints)),
+		client:    &http.Client{Timeout: cfg.Timeout},
+		pending:   make(map[string]*delivery),
+		done:      make(chan struct{}),
+	}
+	for _, e := range endpoints {
+		d.endpoints[e.WebsiteURL] = e
+	}
+
+	err = d.loadQueue()
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// LoadEndpoints reads a JSON array of endpoints from a file.
+func LoadEndpoints(path string) ([]Endpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var endpoints []Endpoint
+	err = json.Unmarshal(b, &endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return endpoints, nil
+}
+
+// Enqueue queues a session for delivery. Sessions for websites without an endpoint are ignored.
+// It's meant to be used as a `data.StateHook` for completed sessions.
+func (d *Dispatcher) Enqueue(s *data.Data) error {
+	if _, ok := d.endpoints[s.WebsiteURL]; !ok {
+		return nil
+	}
+
+	body, err := json.Marshal(Payload{
+		WebsiteURLHash: hash.New(s.WebsiteURL),
+		Session:        s,
+	})
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.nextID++
+	dl := &delivery{
+		ID:          strconv.FormatInt(time.Now().UnixNano(), 10) + "-" + strconv.FormatUint(d.nextID, 10),
+		WebsiteURL:  s.WebsiteURL,
+		Body:        body,
+		NextAttempt: time.Now(),
+	}
+
+	err = d.persist(dl)
+	if err != nil {
+		return err
+	}
+	d.pending[dl.ID] = dl
+	return nil
+}
+
+// Start delivers whatever is due every interval, in the background, until Close is called.
+func (d *Dispatcher) Start(interval time.Duration) {
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				d.deliverDue(now)
+			case <-d.done:
+				return
+			}
+		}
+	}()
+}
+
+// Close stops delivering. Pending deliveries stay in the queue directory for next time.
+func (d *Dispatcher) Close() error {
+	close(d.done)
+	d.wg.Wait()
+	return nil
+}
+
+// deliverDue tries every delivery whose next attempt is due.
+func (d *Dispatcher) deliverDue(now time.Time) {
+	d.mu.Lock()
+	var due []*delivery
+	for _, dl := range d.pending {
+		if !dl.NextAttempt.After(now) {
+			due = append(due, dl)
+		}
+	}
+	d.mu.Unlock()
+
+	for _, dl := range due {
+		err := d.send(dl)
+		d.settle(dl, err, now)
+	}
+}
+
+func (d *Dispatcher) send(dl *delivery) error {
+	e, ok := d.endpoints[dl.WebsiteURL]
+	if !ok {
+		return errNoEndpoint
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.URL, bytes.NewReader(dl.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, dl.ID)
+	req.Header.Set(SignatureHeader, Sign(e.Secret, dl.Body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%v (status %v)", errDeliveryFailed, resp.StatusCode)
+	}
+	return nil
+}
+
+// settle records the outcome of an attempt: delivered ones are removed from the queue, failed
+// ones are rescheduled or, if they've run out of attempts, dead-lettered.
+func (d *Dispatcher) settle(dl *delivery, sendErr error, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dl.Attempts++
+	if sendErr == nil {
+		d.remove(dl)
+		return
+	}
+
+	dl.LastError = sendErr.Error()
+	// There's no point retrying a delivery nobody wants anymore
+	if dl.Attempts >= d.cfg.MaxAttempts || sendErr == errNoEndpoint {
+		log.Printf("Giving up on webhook delivery %v after %v attempts | Error: %v", dl.ID, dl.Attempts, sendErr)
+		err := d.deadLetter(dl)
+		if err != nil {
+			log.Println("Failed to dead-letter webhook delivery | Error:", err)
+			return
+		}
+		d.remove(dl)
+		return
+	}
+
+	dl.NextAttempt = now.Add(d.backoff(dl.Attempts))
+	err := d.persist(dl)
+	if err != nil {
+		log.Println("Failed to persist webhook delivery | Error:", err)
+	}
+}
+
+// backoff returns how long to wait after the given number of failed attempts.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	b := d.cfg.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		b *= 2
+		if b >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return b
+}
+
+// The following must be called with the lock held.
+
+func (d *Dispatcher) persist(dl *delivery) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file and rename, so we never leave a half-written delivery behind.
+	path := d.deliveryPath(dl.ID)
+	err = ioutil.WriteFile(path+".tmp", b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func (d *Dispatcher) remove(dl *delivery) {
+	delete(d.pending, dl.ID)
+	err := os.Remove(d.deliveryPath(dl.ID))
+	if err != nil && !os.IsNotExist(err) {
+		log.Println("Failed to remove webhook delivery from the queue | Error:", err)
+	}
+}
+
+func (d *Dispatcher) deadLetter(dl *delivery) error {
+	b, err := json.Marshal(dl)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(d.cfg.DeadLetterFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(b, '\n'))
+	return err
+}
+
+func (d *Dispatcher) deliveryPath(id string) string {
+	return filepath.Join(d.cfg.QueueDir, id+deliveryFileExt)
+}
+
+func (d *Dispatcher) loadQueue() error {
+	files, err := ioutil.ReadDir(d.cfg.QueueDir)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), deliveryFileExt) {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(d.cfg.QueueDir, f.Name()))
+		if err != nil {
+			return err
+		}
+
+		var dl delivery
+		err = json.Unmarshal(b, &dl)
+		if err != nil {
+			return err
+		}
+		d.pending[dl.ID] = &dl
+	}
+	return nil
+}
+
+// Sign returns the signature of body for the given secret, as sent in SignatureHeader.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify says if signature is the right one for body and secret. Receivers can use it to check
+// deliveries really came from us.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
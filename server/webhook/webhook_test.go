@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hugoamvieira/code-test/server/data"
+	"github.com/hugoamvieira/code-test/server/hash"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// receiver is a local webhook receiver that fails the first `failures` requests it gets.
+type receiver struct {
+	failures int
+	bodies   [][]byte
+	sigs     []string
+	mu       sync.Mutex
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	b, _ := ioutil.ReadAll(r.Body)
+	rc.bodies = append(rc.bodies, b)
+	rc.sigs = append(rc.sigs, r.Header.Get(SignatureHeader))
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func testConfig(dir string) Config {
+	return Config{
+		QueueDir:       filepath.Join(dir, "queue"),
+		DeadLetterFile: filepath.Join(dir, "dead-letter.ndjson"),
+		MaxAttempts:    3,
+		BaseBackoff:    time.Second,
+		MaxBackoff:     time.Minute,
+		Timeout:        time.Second,
+	}
+}
+
+func completedSession() *data.Data {
+	return &data.Data{
+		WebsiteURL:         "https://www.website.com",
+		SessionID:          "session",
+		FormCompletionTime: 10,
+		State:              data.StateCompleted,
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	Convey("Given a dispatcher with an endpoint for a website", t, func() {
+		dir, err := ioutil.TempDir("", "webhook")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		rc := &receiver{}
+		srv := httptest.NewServer(rc)
+		defer srv.Close()
+
+		endpoint := Endpoint{
+			WebsiteURL: "https://www.website.com",
+			URL:        srv.URL,
+			Secret:     "secret",
+		}
+		cfg := testConfig(dir)
+		d, err := NewDispatcher(cfg, []Endpoint{endpoint})
+		So(err, ShouldBeNil)
+
+		Convey("a completed session should be delivered, signed, with its URL hash", func() {
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+			d.deliverDue(time.Now())
+
+			So(len(rc.bodies), ShouldEqual, 1)
+			So(Verify("secret", rc.bodies[0], rc.sigs[0]), ShouldBeTrue)
+			So(Verify("wrong", rc.bodies[0], rc.sigs[0]), ShouldBeFalse)
+
+			var p Payload
+			So(json.Unmarshal(rc.bodies[0], &p), ShouldBeNil)
+			So(p.WebsiteURLHash, ShouldEqual, hash.New("https://www.website.com"))
+			So(p.Session.SessionID, ShouldEqual, "session")
+
+			Convey("and removed from the queue", func() {
+				files, _ := ioutil.ReadDir(cfg.QueueDir)
+				So(files, ShouldBeEmpty)
+				So(d.pending, ShouldBeEmpty)
+			})
+		})
+
+		Convey("a session for a website without an endpoint should be ignored", func() {
+			s := completedSession()
+			s.WebsiteURL = "https://www.otherwebsite.com"
+			So(d.Enqueue(s), ShouldBeNil)
+			So(d.pending, ShouldBeEmpty)
+		})
+
+		Convey("a failed delivery should be retried with exponential backoff", func() {
+			rc.failures = 1
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+			now := time.Now()
+
+			d.deliverDue(now)
+			So(len(rc.bodies), ShouldEqual, 1)
+			So(len(d.pending), ShouldEqual, 1)
+
+			// Not due yet
+			d.deliverDue(now.Add(500 * time.Millisecond))
+			So(len(rc.bodies), ShouldEqual, 1)
+
+			d.deliverDue(now.Add(time.Second))
+			So(len(rc.bodies), ShouldEqual, 2)
+			So(d.pending, ShouldBeEmpty)
+		})
+
+		Convey("a delivery that keeps failing should be dead-lettered", func() {
+			rc.failures = 100
+			now := time.Now()
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+
+			for i := 0; i < cfg.MaxAttempts; i++ {
+				now = now.Add(time.Hour)
+				d.deliverDue(now)
+			}
+			So(len(rc.bodies), ShouldEqual, cfg.MaxAttempts)
+			So(d.pending, ShouldBeEmpty)
+
+			b, err := ioutil.ReadFile(cfg.DeadLetterFile)
+			So(err, ShouldBeNil)
+			So(strings.Count(string(b), "\n"), ShouldEqual, 1)
+			So(string(b), ShouldContainSubstring, `"attempts":3`)
+			So(string(b), ShouldNotContainSubstring, "secret")
+		})
+
+		Convey("queued deliveries shouldn't keep the endpoint, and should use the current one", func() {
+			rc.failures = 1
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+			d.deliverDue(time.Now())
+
+			files, err := ioutil.ReadDir(cfg.QueueDir)
+			So(err, ShouldBeNil)
+			So(len(files), ShouldEqual, 1)
+			b, err := ioutil.ReadFile(filepath.Join(cfg.QueueDir, files[0].Name()))
+			So(err, ShouldBeNil)
+			So(string(b), ShouldNotContainSubstring, "secret")
+
+			endpoint.Secret = "rotated"
+			restarted, err := NewDispatcher(cfg, []Endpoint{endpoint})
+			So(err, ShouldBeNil)
+			restarted.deliverDue(time.Now().Add(time.Hour))
+			So(len(rc.bodies), ShouldEqual, 2)
+			So(Verify("rotated", rc.bodies[1], rc.sigs[1]), ShouldBeTrue)
+		})
+
+		Convey("a delivery for a website that lost its endpoint should be dead-lettered straight away", func() {
+			rc.failures = 1
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+			d.deliverDue(time.Now())
+
+			restarted, err := NewDispatcher(cfg, nil)
+			So(err, ShouldBeNil)
+			restarted.deliverDue(time.Now().Add(time.Hour))
+			So(len(rc.bodies), ShouldEqual, 1)
+			So(restarted.pending, ShouldBeEmpty)
+
+			b, err := ioutil.ReadFile(cfg.DeadLetterFile)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldContainSubstring, errNoEndpoint.Error())
+		})
+
+		Convey("pending deliveries should survive a restart", func() {
+			rc.failures = 1
+			So(d.Enqueue(completedSession()), ShouldBeNil)
+			d.deliverDue(time.Now())
+
+			restarted, err := NewDispatcher(cfg, []Endpoint{endpoint})
+			So(err, ShouldBeNil)
+			So(len(restarted.pending), ShouldEqual, 1)
+
+			restarted.deliverDue(time.Now().Add(time.Hour))
+			So(len(rc.bodies), ShouldEqual, 2)
+			So(restarted.pending, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestBackoff(t *testing.T) {
+	Convey("Given a dispatcher", t, func() {
+		d := &Dispatcher{cfg: Config{BaseBackoff: time.Second, MaxBackoff: 10 * time.Second}}
+
+		Convey("backoff should double after every attempt, up to the maximum", func() {
+			So(d.backoff(1), ShouldEqual, time.Second)
+			So(d.backoff(2), ShouldEqual, 2*time.Second)
+			So(d.backoff(3), ShouldEqual, 4*time.Second)
+			So(d.backoff(4), ShouldEqual, 8*time.Second)
+			So(d.backoff(5), ShouldEqual, 10*time.Second)
+			So(d.backoff(50), ShouldEqual, 10*time.Second)
+		})
+	})
+}